@@ -4,6 +4,16 @@ import (
 	"github.com/m-garey/fetchit-backend/internal/application"
 )
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from /api/auth/login, sent as "Bearer <token>".
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Store API key for point-of-sale terminals.
+
 // MAIN METHOD
 func main() {
 	application.Run()
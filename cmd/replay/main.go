@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/repository"
+)
+
+const usage = `usage: replay [-user ID] [-store ID] [-all] [-dry-run] [-delete-without-history] [-json]
+
+Rebuilds User_Sticker_Progress from the Purchases ledger using the current
+Sticker_Level_Requirements. Pass -user and/or -store to limit the rebuild,
+or -all to rebuild every sticker. Stickers with no purchases in the ledger
+are reported and kept unless -delete-without-history is given.
+
+`
+
+// MAIN METHOD
+func main() {
+	userID := flag.String("user", "", "only rebuild stickers of this user")
+	storeID := flag.String("store", "", "only rebuild stickers of this store")
+	all := flag.Bool("all", false, "rebuild every sticker")
+	dryRun := flag.Bool("dry-run", false, "report differences without writing them")
+	deleteWithoutHistory := flag.Bool("delete-without-history", false, "delete stickers that have no purchases in the ledger")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (*userID == "" && *storeID == "") == !*all {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx := context.Background()
+	pool, err := repository.NewPool(ctx, cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer pool.Close()
+
+	repo := repository.New(pool)
+	report, err := repo.ReplayProgress(ctx, models.ReplayRequest{
+		UserID:               *userID,
+		StoreID:              *storeID,
+		DryRun:               *dryRun,
+		DeleteWithoutHistory: *deleteWithoutHistory,
+	})
+	if err != nil {
+		log.Fatalf("replay failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("failed to write report: %v", err)
+		}
+		return
+	}
+
+	for _, d := range report.Diffs {
+		after := describe(d.After)
+		if d.NoLedgerHistory && !*deleteWithoutHistory {
+			after = "(kept, no ledger history)"
+		}
+		fmt.Printf("%s %s: %s -> %s\n", d.UserID, d.StoreID, describe(d.Before), after)
+	}
+	verb := "updated"
+	if report.DryRun {
+		verb = "would update"
+	}
+	fmt.Printf("scanned %d stickers, %s %d\n", report.Scanned, verb, report.Changed)
+}
+
+func describe(s *models.StickerState) string {
+	if s == nil {
+		return "(none)"
+	}
+	return fmt.Sprintf("%s/%d", s.Level, s.StarCount)
+}
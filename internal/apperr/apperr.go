@@ -0,0 +1,106 @@
+package apperr
+
+import (
+	"errors"
+)
+
+// Kind classifies an error by what the caller can do about it. The HTTP layer
+// maps each kind to a status code.
+type Kind string
+
+const (
+	KindInternal      Kind = "internal"
+	KindNotFound      Kind = "not_found"
+	KindConflict      Kind = "conflict"
+	KindValidation    Kind = "validation"
+	KindUnprocessable Kind = "unprocessable"
+	KindUnavailable   Kind = "unavailable"
+	// KindUnauthenticated means the caller did not prove who they are;
+	// KindForbidden means they did, but may not do this.
+	KindUnauthenticated Kind = "unauthenticated"
+	KindForbidden       Kind = "forbidden"
+)
+
+// FieldError points at one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error. Message and Fields are safe to show to API clients;
+// Err keeps the underlying cause for logs and errors.Is/As.
+type Error struct {
+	Kind    Kind
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Wrap attaches a kind and client-facing message to err.
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// InvalidFields is a validation error carrying per-field details.
+func InvalidFields(message string, fields []FieldError, err error) *Error {
+	return &Error{Kind: KindValidation, Message: message, Fields: fields, Err: err}
+}
+
+func NotFound(message string) *Error {
+	return New(KindNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(KindConflict, message)
+}
+
+func Validation(message string) *Error {
+	return New(KindValidation, message)
+}
+
+func Unprocessable(message string) *Error {
+	return New(KindUnprocessable, message)
+}
+
+func Unavailable(message string) *Error {
+	return New(KindUnavailable, message)
+}
+
+func Unauthenticated(message string) *Error {
+	return New(KindUnauthenticated, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(KindForbidden, message)
+}
+
+// KindOf returns the kind of the first domain error in err's chain, or
+// KindInternal if there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// Is reports whether err carries a domain error of the given kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
@@ -0,0 +1,44 @@
+package apperr_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	cause := errors.New("connection reset")
+
+	tests := []struct {
+		name string
+		err  error
+		want apperr.Kind
+	}{
+		{"plain error", cause, apperr.KindInternal},
+		{"not found", apperr.NotFound("user not found"), apperr.KindNotFound},
+		{"conflict", apperr.Conflict("username taken"), apperr.KindConflict},
+		{"validation", apperr.Validation("bad input"), apperr.KindValidation},
+		{"unprocessable", apperr.Unprocessable("key reused"), apperr.KindUnprocessable},
+		{"wrapped unavailable", apperr.Wrap(apperr.KindUnavailable, "database unavailable", cause), apperr.KindUnavailable},
+		{"fmt wrapped", fmt.Errorf("insert user: %w", apperr.Conflict("username taken")), apperr.KindConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, apperr.KindOf(tt.err))
+			assert.True(t, apperr.Is(tt.err, tt.want))
+		})
+	}
+}
+
+func TestError_Unwrap(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := apperr.Wrap(apperr.KindUnavailable, "database unavailable", cause)
+
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "database unavailable: connection reset", err.Error())
+	assert.False(t, apperr.Is(nil, apperr.KindInternal))
+}
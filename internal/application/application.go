@@ -2,7 +2,7 @@ package application
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,34 +12,79 @@ import (
 	_ "github.com/m-garey/fetchit-backend/docs"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/m-garey/fetchit-backend/internal/emailtoken"
+	"github.com/m-garey/fetchit-backend/internal/events"
 	"github.com/m-garey/fetchit-backend/internal/handler"
+	"github.com/m-garey/fetchit-backend/internal/live"
+	"github.com/m-garey/fetchit-backend/internal/logging"
+	"github.com/m-garey/fetchit-backend/internal/mailer"
+	"github.com/m-garey/fetchit-backend/internal/metrics"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/outbox"
 	"github.com/m-garey/fetchit-backend/internal/repository"
+	"github.com/m-garey/fetchit-backend/internal/tracing"
+	"github.com/m-garey/fetchit-backend/internal/webhook"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-const port string = "8080"
-
 func Run() {
-	db := setupDB()
-	defer db.Close(context.Background())
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.Logging))
+
+	shutdownTracing := setupTracing(cfg.Tracing)
 
-	repo := repository.New(db)
-	h := handler.New(repo)
-	router := setupRouter()
-	setupHandler(router, h)
+	db := setupDB(cfg.Database)
+	defer db.Close()
+
+	m := metrics.New()
+	m.Register(metrics.NewPoolCollector(db))
+	repo := m.Repository(repository.New(db,
+		repository.WithQueryTimeout(cfg.Database.QueryTimeout),
+		repository.WithIdempotencyTTL(cfg.IdempotencyTTL),
+	))
+	tokens := setupAuth(cfg.Auth)
+	grantAdmins(repo, cfg.Auth.AdminUserIDs)
+	bus := events.New(events.WithBuffer(int(cfg.Events.Buffer)), events.WithHistory(int(cfg.Events.History)))
+	hub := live.New(bus, live.WithKeepalive(cfg.Events.Heartbeat), live.WithSendBuffer(int(cfg.Events.Buffer)))
+	h := handler.New(repo,
+		handler.WithMailer(setupMailer(cfg.Mail)),
+		handler.WithEmailVerification(setupEmailTokens(cfg.EmailVerification), cfg.EmailVerification.URL),
+		handler.WithAuth(tokens),
+		handler.WithEvents(bus, cfg.Events.Heartbeat),
+		handler.WithLiveUpdates(hub),
+	)
+	router := setupRouter(m)
+	setupHandler(router, h, tokens, repo)
+	stopOutbox := background(setupOutbox(cfg.Outbox, repo, bus).Run)
+	stopWebhooks := background(setupWebhooks(cfg.Webhooks, repo).Run)
 
 	srv := &http.Server{
-		Addr:    ":" + port,
+		Addr:    ":" + cfg.Port,
 		Handler: router,
 	}
+	// Event streams never finish on their own, and Shutdown does not track
+	// WebSockets at all; end both so clients are told to reconnect elsewhere.
+	// The relay stops first: what it marks sent must reach the bus while
+	// listeners are still there.
+	srv.RegisterOnShutdown(func() {
+		stopOutbox()
+		hub.Shutdown()
+		bus.Close()
+	})
 
 	// Start server in goroutine for graceful shutdown
 	go func() {
-		log.Printf("HTTP server listening on %s", srv.Addr)
+		slog.Info("HTTP server listening", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("failed to start server: %v", err)
+			fatal("failed to start server", err)
 		}
 	}()
 
@@ -47,46 +92,162 @@ func Run() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("shutting down server...")
+	slog.Info("shutting down server")
 
 	// Gracefully shutdown with 10s timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("server shutdown failed: %v", err)
+		fatal("server shutdown failed", err)
+	}
+	// Shutdown does not wait for its hooks; wait here for the relay too.
+	stopOutbox()
+	stopWebhooks()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing traces failed", "error", err)
 	}
 
-	log.Println("server stopped gracefully")
+	slog.Info("server stopped gracefully")
 }
 
-func setupDB() *pgx.Conn {
-	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
+func setupTracing(cfg config.Tracing) func(context.Context) error {
+	shutdown, err := tracing.Setup(context.Background(), cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+		fatal("failed to set up tracing", err)
+	}
+	return shutdown
+}
+
+func setupDB(cfg config.Database) *pgxpool.Pool {
+	pool, err := repository.NewPool(context.Background(), cfg)
+	if err != nil {
+		fatal("failed to connect to the database", err)
 	}
 
 	// Example query to test connection
 	var version string
-	if err := conn.QueryRow(context.Background(), "SELECT version()").Scan(&version); err != nil {
-		log.Fatalf("Query failed: %v", err)
+	if err := pool.QueryRow(context.Background(), "SELECT version()").Scan(&version); err != nil {
+		fatal("query failed", err)
+	}
+
+	slog.Info("connected to the database", "version", version)
+
+	return pool
+}
+
+func setupMailer(cfg config.Mail) mailer.Mailer {
+	if cfg.Driver == "smtp" {
+		return mailer.NewSMTP(cfg.SMTPHost, int(cfg.SMTPPort), cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	}
+
+	if cfg.LogFile == "" {
+		return mailer.NewLog(os.Stderr, cfg.From)
+	}
+	f, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		fatal("failed to open mail log", err, "path", cfg.LogFile)
+	}
+	return mailer.NewLog(f, cfg.From)
+}
+
+func setupEmailTokens(cfg config.EmailVerification) *emailtoken.Signer {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		slog.Warn("EMAIL_VERIFICATION_SECRET is not set; verification links will stop working on restart")
+		secret = emailtoken.GenerateSecret()
+	}
+	return emailtoken.New(secret, cfg.TTL)
+}
+
+func setupAuth(cfg config.Auth) *auth.Tokens {
+	keys, kid := cfg.Keys, cfg.SigningKeyID
+	if len(keys) == 0 {
+		slog.Warn("JWT_KEYS is not set; access tokens will stop working on restart")
+		kid = "generated"
+		keys = map[string][]byte{kid: auth.GenerateKey()}
+	}
+
+	tokens, err := auth.NewTokens(keys, kid, cfg.AccessTTL, cfg.RefreshTTL)
+	if err != nil {
+		fatal("invalid auth configuration", err)
+	}
+	return tokens
+}
+
+func setupWebhooks(cfg config.Webhooks, store webhook.Store) *webhook.Dispatcher {
+	return webhook.NewDispatcher(store,
+		webhook.WithMaxAttempts(int(cfg.MaxAttempts)),
+		webhook.WithBackoff(cfg.Backoff),
+		webhook.WithTimeout(cfg.Timeout),
+		webhook.WithPollInterval(cfg.PollInterval),
+	)
+}
+
+// setupOutbox builds the relay that publishes sticker events once their
+// purchase has committed.
+func setupOutbox(cfg config.Outbox, repo repository.API, bus *events.Bus) *outbox.Relay {
+	var publishers outbox.Publishers
+	for _, name := range cfg.Publishers {
+		switch name {
+		case "webhooks":
+			publishers = append(publishers, outbox.Webhooks(repo))
+		case "events":
+			publishers = append(publishers, outbox.Bus(bus))
+		case "log":
+			publishers = append(publishers, outbox.Log(slog.Default()))
+		}
 	}
+	return outbox.NewRelay(repo, publishers,
+		outbox.WithPollInterval(cfg.PollInterval), outbox.WithRetention(cfg.Retention))
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"error", err}, args...)...)
+	os.Exit(1)
+}
 
-	log.Println("Connected to:", version)
+// background runs fn until the returned stop function is called, which waits
+// for fn to return. Calling stop again waits the same way.
+func background(fn func(context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
 
-	return conn
+func grantAdmins(repo repository.API, userIDs []string) {
+	for _, userID := range userIDs {
+		_, err := repo.AssignRole(context.Background(), userID, models.RoleRequest{Role: models.RoleAdmin})
+		if err != nil && !apperr.Is(err, apperr.KindConflict) {
+			fatal("failed to grant admin role", err, "user_id", userID)
+		}
+	}
 }
 
-func setupRouter() *gin.Engine {
-	r := gin.Default()
+func setupRouter(m *metrics.Metrics) *gin.Engine {
+	r := gin.New()
 
 	// Middleware
-	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(m.Middleware())
+	r.Use(logging.Recovery())
+	r.Use(handler.ErrorHandler())
 
 	// Swagger endpoint
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Prometheus scrape endpoint
+	r.GET("/metrics", gin.WrapH(m.Handler()))
+
 	// Health Check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -97,13 +258,76 @@ func setupRouter() *gin.Engine {
 	return r
 }
 
-func setupHandler(r *gin.Engine, h handler.API) {
-	api := r.Group("/api")
+// setupHandler registers the routes and who may call them. Every
+// authenticated user is a customer; store operators additionally manage the
+// stores they were assigned and admins may do anything.
+func setupHandler(r *gin.Engine, h handler.API, tokens *auth.Tokens, repo authStore) {
+	public := r.Group("/api")
+	{
+		public.POST("/auth/signup", h.Signup)
+		public.POST("/auth/login", h.Login)
+		public.POST("/auth/refresh", h.Refresh)
+		public.POST("/auth/logout", h.Logout)
+		public.GET("/verify-email", h.VerifyEmail)
+		public.POST("/verify-email", h.VerifyEmail)
+		// Browsers cannot send headers with a WebSocket, so it authenticates
+		// in its first message instead.
+		public.GET("/live", h.LiveUpdates)
+	}
+
+	api := r.Group("/api", auth.Middleware(tokens), auth.LoadRoles(repo))
+	{
+		api.GET("/stores", h.ListStores)
+		api.GET("/stores/:store_id", h.GetStore)
+		api.GET("/levels", h.ListLevels)
+
+		// Users may only act on their own account.
+		user := api.Group("/users/:user_id", auth.RequireSelf("user_id"))
+		user.GET("", h.GetUser)
+		user.PATCH("", h.UpdateUser)
+		user.DELETE("", h.DeleteUser)
+		user.PUT("/email", h.UpdateEmail)
+		user.GET("/stickers", h.GetStickersByUser)
+		user.GET("/stickers/:store_id", h.GetSticker)
+		user.GET("/purchases", h.ListUserPurchases)
+		user.GET("/events", h.StreamEvents)
+
+		// Store operators manage the stores they were assigned.
+		store := api.Group("/stores/:store_id", auth.RequireOwnStore("store_id"))
+		store.PATCH("", h.UpdateStore)
+		store.GET("/stats", h.GetStoreStats)
+		store.POST("/api-keys", h.CreateAPIKey)
+		store.GET("/api-keys", h.ListAPIKeys)
+		store.DELETE("/api-keys/:key_id", h.RevokeAPIKey)
+		store.POST("/webhooks", h.CreateWebhook)
+		store.GET("/webhooks", h.ListWebhooks)
+		store.DELETE("/webhooks/:webhook_id", h.DeleteWebhook)
+		store.GET("/webhooks/:webhook_id/deliveries", h.ListWebhookDeliveries)
+
+		admin := api.Group("", auth.RequireAdmin())
+		admin.POST("/users", h.CreateUser)
+		admin.GET("/users", h.ListUsers)
+		admin.POST("/stores", h.CreateStore)
+		admin.POST("/stores/:store_id/deactivate", h.DeactivateStore)
+		admin.POST("/stores/:store_id/reactivate", h.ReactivateStore)
+		admin.POST("/admin/replay", h.ReplayProgress)
+		admin.PATCH("/admin/levels/:level", h.UpdateLevel)
+		admin.GET("/admin/users/:user_id/roles", h.ListRoles)
+		admin.POST("/admin/users/:user_id/roles", h.AssignRole)
+		admin.DELETE("/admin/users/:user_id/roles/:role_id", h.RevokeRole)
+	}
+
+	// Store terminals call these with an API key instead of a user token.
+	pos := r.Group("/api", auth.MiddlewareWithAPIKeys(tokens, repo), auth.LoadRoles(repo))
 	{
-		api.POST("/users", h.CreateUser)
-		api.POST("/stores", h.CreateStore)
-		api.POST("/purchase", h.RecordPurchase)
-		api.GET("/stickers/:user_id", h.GetStickersByUser)
-		api.GET("/stickers/:user_id/:store_id", h.GetSticker)
+		pos.POST("/purchase", auth.RequireScope(models.ScopePurchasesWrite), h.RecordPurchase)
+		pos.GET("/stores/:store_id/purchases", auth.RequireScope(models.ScopePurchasesRead),
+			auth.RequireOwnStore("store_id"), h.ListStorePurchases)
 	}
 }
+
+// authStore is the part of the repository the auth middlewares read.
+type authStore interface {
+	auth.APIKeyStore
+	auth.RoleStore
+}
@@ -0,0 +1,218 @@
+package application
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/handler"
+	"github.com/m-garey/fetchit-backend/internal/mocks"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// allowAll answers every route with 200 so the tests below only see what the
+// middlewares in setupHandler decide.
+type allowAll struct{}
+
+var _ handler.API = allowAll{}
+
+func (allowAll) Signup(c *gin.Context)                { c.Status(http.StatusOK) }
+func (allowAll) Login(c *gin.Context)                 { c.Status(http.StatusOK) }
+func (allowAll) Refresh(c *gin.Context)               { c.Status(http.StatusOK) }
+func (allowAll) Logout(c *gin.Context)                { c.Status(http.StatusOK) }
+func (allowAll) CreateUser(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) GetUser(c *gin.Context)               { c.Status(http.StatusOK) }
+func (allowAll) UpdateUser(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) DeleteUser(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) ListUsers(c *gin.Context)             { c.Status(http.StatusOK) }
+func (allowAll) UpdateEmail(c *gin.Context)           { c.Status(http.StatusOK) }
+func (allowAll) VerifyEmail(c *gin.Context)           { c.Status(http.StatusOK) }
+func (allowAll) CreateStore(c *gin.Context)           { c.Status(http.StatusOK) }
+func (allowAll) GetStore(c *gin.Context)              { c.Status(http.StatusOK) }
+func (allowAll) UpdateStore(c *gin.Context)           { c.Status(http.StatusOK) }
+func (allowAll) DeactivateStore(c *gin.Context)       { c.Status(http.StatusOK) }
+func (allowAll) ReactivateStore(c *gin.Context)       { c.Status(http.StatusOK) }
+func (allowAll) ListStores(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) GetStoreStats(c *gin.Context)         { c.Status(http.StatusOK) }
+func (allowAll) CreateAPIKey(c *gin.Context)          { c.Status(http.StatusOK) }
+func (allowAll) ListAPIKeys(c *gin.Context)           { c.Status(http.StatusOK) }
+func (allowAll) RevokeAPIKey(c *gin.Context)          { c.Status(http.StatusOK) }
+func (allowAll) CreateWebhook(c *gin.Context)         { c.Status(http.StatusOK) }
+func (allowAll) ListWebhooks(c *gin.Context)          { c.Status(http.StatusOK) }
+func (allowAll) DeleteWebhook(c *gin.Context)         { c.Status(http.StatusOK) }
+func (allowAll) ListWebhookDeliveries(c *gin.Context) { c.Status(http.StatusOK) }
+func (allowAll) RecordPurchase(c *gin.Context)        { c.Status(http.StatusOK) }
+func (allowAll) GetSticker(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) GetStickersByUser(c *gin.Context)     { c.Status(http.StatusOK) }
+func (allowAll) ListUserPurchases(c *gin.Context)     { c.Status(http.StatusOK) }
+func (allowAll) ListStorePurchases(c *gin.Context)    { c.Status(http.StatusOK) }
+func (allowAll) ReplayProgress(c *gin.Context)        { c.Status(http.StatusOK) }
+func (allowAll) ListLevels(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) UpdateLevel(c *gin.Context)           { c.Status(http.StatusOK) }
+func (allowAll) ListRoles(c *gin.Context)             { c.Status(http.StatusOK) }
+func (allowAll) AssignRole(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) RevokeRole(c *gin.Context)            { c.Status(http.StatusOK) }
+func (allowAll) StreamEvents(c *gin.Context)          { c.Status(http.StatusOK) }
+func (allowAll) LiveUpdates(c *gin.Context)           { c.Status(http.StatusOK) }
+
+const (
+	customerID = "4f1c2b8e-6a8d-4c0e-9d1a-2f6b7e3c9a10"
+	operatorID = "0d6f3a52-7b1e-4c9a-a2f4-5e8b9c1d7a36"
+	adminID    = "7a2e9c41-5d3b-4f6a-8e1c-9b0d2f4a6c85"
+	storeID    = "9b2d7e41-3c5f-4a8b-8e6d-1f0a2c4b6d83"
+	otherStore = "e2b4c6d8-1a3f-4b5c-8d7e-9f0a1b2c3d4e"
+	keyID      = "c3a8e5f1-2b7d-4e6a-9f0c-8d1b3a5e7c29"
+	roleID     = "5e7c9a1b-3d5f-4b8e-a0c2-4e6a8c0b2d4f"
+)
+
+func TestSetupHandler_Permissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens, err := auth.NewTokens(map[string][]byte{"test": []byte("secret")}, "test", time.Minute, time.Hour)
+	require.NoError(t, err)
+
+	writeKey, writeHash := auth.NewAPIKey()
+	readKey, readHash := auth.NewAPIKey()
+	repo := new(mocks.MockRepository)
+	repo.On("ListRoles", mock.Anything, customerID).Return(models.Roles{}, nil)
+	repo.On("ListRoles", mock.Anything, operatorID).Return(models.Roles{{Role: models.RoleStoreOperator, StoreID: storeID}}, nil)
+	repo.On("ListRoles", mock.Anything, adminID).Return(models.Roles{{Role: models.RoleAdmin}}, nil)
+	repo.On("AuthenticateAPIKey", mock.Anything, writeHash).
+		Return(models.APIKey{ID: keyID, StoreID: storeID, Scopes: []string{models.ScopePurchasesWrite}}, nil)
+	repo.On("AuthenticateAPIKey", mock.Anything, readHash).
+		Return(models.APIKey{ID: keyID, StoreID: storeID, Scopes: []string{models.ScopePurchasesRead}}, nil)
+
+	r := gin.New()
+	r.Use(handler.ErrorHandler())
+	setupHandler(r, allowAll{}, tokens, repo)
+
+	callers := map[string]map[string]string{
+		"anonymous": {},
+		"write key": {auth.APIKeyHeader: writeKey},
+		"read key":  {auth.APIKeyHeader: readKey},
+	}
+	for name, userID := range map[string]string{"customer": customerID, "operator": operatorID, "admin": adminID} {
+		access, err := tokens.IssueAccess(userID)
+		require.NoError(t, err)
+		callers[name] = map[string]string{"Authorization": "Bearer " + access}
+	}
+
+	const (
+		ok        = http.StatusOK
+		forbidden = http.StatusForbidden
+		anonymous = http.StatusUnauthorized
+	)
+	user := "/api/users/" + customerID
+	store := "/api/stores/" + storeID
+
+	// want lists the status for anonymous, customer, operator (of storeID)
+	// and admin callers.
+	tests := []struct {
+		method string
+		path   string
+		want   [4]int
+	}{
+		{"POST", "/api/auth/login", [4]int{ok, ok, ok, ok}},
+		{"GET", "/api/verify-email", [4]int{ok, ok, ok, ok}},
+		{"GET", "/api/live", [4]int{ok, ok, ok, ok}},
+		{"GET", "/api/stores", [4]int{anonymous, ok, ok, ok}},
+		{"GET", store, [4]int{anonymous, ok, ok, ok}},
+		{"GET", "/api/levels", [4]int{anonymous, ok, ok, ok}},
+		{"POST", "/api/purchase", [4]int{anonymous, ok, ok, ok}},
+
+		{"GET", user, [4]int{anonymous, ok, forbidden, ok}},
+		{"PATCH", user, [4]int{anonymous, ok, forbidden, ok}},
+		{"DELETE", user, [4]int{anonymous, ok, forbidden, ok}},
+		{"PUT", user + "/email", [4]int{anonymous, ok, forbidden, ok}},
+		{"GET", user + "/stickers", [4]int{anonymous, ok, forbidden, ok}},
+		{"GET", user + "/stickers/" + storeID, [4]int{anonymous, ok, forbidden, ok}},
+		{"GET", user + "/purchases", [4]int{anonymous, ok, forbidden, ok}},
+		{"GET", user + "/events", [4]int{anonymous, ok, forbidden, ok}},
+
+		{"PATCH", store, [4]int{anonymous, forbidden, ok, ok}},
+		{"GET", store + "/stats", [4]int{anonymous, forbidden, ok, ok}},
+		{"GET", "/api/stores/" + otherStore + "/stats", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"GET", store + "/purchases", [4]int{anonymous, forbidden, ok, ok}},
+		{"POST", store + "/api-keys", [4]int{anonymous, forbidden, ok, ok}},
+		{"GET", store + "/api-keys", [4]int{anonymous, forbidden, ok, ok}},
+		{"DELETE", store + "/api-keys/" + keyID, [4]int{anonymous, forbidden, ok, ok}},
+		{"DELETE", "/api/stores/" + otherStore + "/api-keys/" + keyID, [4]int{anonymous, forbidden, forbidden, ok}},
+		{"POST", store + "/webhooks", [4]int{anonymous, forbidden, ok, ok}},
+		{"GET", store + "/webhooks", [4]int{anonymous, forbidden, ok, ok}},
+		{"DELETE", store + "/webhooks/" + keyID, [4]int{anonymous, forbidden, ok, ok}},
+		{"GET", store + "/webhooks/" + keyID + "/deliveries", [4]int{anonymous, forbidden, ok, ok}},
+		{"GET", "/api/stores/" + otherStore + "/webhooks/" + keyID + "/deliveries", [4]int{anonymous, forbidden, forbidden, ok}},
+
+		{"POST", "/api/users", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"GET", "/api/users", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"POST", "/api/stores", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"POST", store + "/deactivate", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"POST", store + "/reactivate", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"POST", "/api/admin/replay", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"PATCH", "/api/admin/levels/bronze", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"GET", "/api/admin/users/" + customerID + "/roles", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"POST", "/api/admin/users/" + customerID + "/roles", [4]int{anonymous, forbidden, forbidden, ok}},
+		{"DELETE", "/api/admin/users/" + customerID + "/roles/" + roleID, [4]int{anonymous, forbidden, forbidden, ok}},
+	}
+
+	for _, tt := range tests {
+		for i, caller := range []string{"anonymous", "customer", "operator", "admin"} {
+			t.Run(caller+" "+tt.method+" "+tt.path, func(t *testing.T) {
+				assert.Equal(t, tt.want[i], serve(r, tt.method, tt.path, callers[caller]))
+			})
+		}
+	}
+
+	// Store API keys only reach the point-of-sale routes, within their scopes
+	// and their own store.
+	keyTests := []struct {
+		caller string
+		method string
+		path   string
+		want   int
+	}{
+		{"write key", "POST", "/api/purchase", ok},
+		{"read key", "POST", "/api/purchase", forbidden},
+		{"read key", "GET", store + "/purchases", ok},
+		{"read key", "GET", "/api/stores/" + otherStore + "/purchases", forbidden},
+		{"write key", "GET", store + "/purchases", forbidden},
+		{"write key", "GET", store, anonymous},
+		{"write key", "GET", store + "/stats", anonymous},
+		{"write key", "GET", user + "/stickers", anonymous},
+	}
+	for _, tt := range keyTests {
+		t.Run(tt.caller+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, serve(r, tt.method, tt.path, callers[tt.caller]))
+		})
+	}
+}
+
+func serve(r http.Handler, method, path string, headers map[string]string) int {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestBackground_StopWaitsForReturn(t *testing.T) {
+	returned := false
+	stop := background(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		returned = true
+	})
+
+	stop()
+	assert.True(t, returned)
+	// The shutdown hook and main both stop the relay.
+	stop()
+}
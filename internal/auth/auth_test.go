@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestTokens(t *testing.T, keys map[string][]byte, kid string) *Tokens {
+	t.Helper()
+	tokens, err := NewTokens(keys, kid, 15*time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestTokens_RoundTrip(t *testing.T) {
+	tokens := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1")}, "k1")
+
+	raw, err := tokens.IssueAccess("user-1")
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(raw, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "k1", parsed.Header["kid"])
+
+	claims, err := tokens.ParseAccess(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+}
+
+func TestTokens_KeyRotation(t *testing.T) {
+	old := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1")}, "k1")
+	issuedBeforeRotation, err := old.IssueAccess("user-1")
+	require.NoError(t, err)
+
+	rotated := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1"), "k2": []byte("secret-2")}, "k2")
+	_, err = rotated.ParseAccess(issuedBeforeRotation)
+	assert.NoError(t, err, "tokens signed by a retired signing key stay valid while the key is listed")
+
+	retired := newTestTokens(t, map[string][]byte{"k2": []byte("secret-2")}, "k2")
+	_, err = retired.ParseAccess(issuedBeforeRotation)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestTokens_Rejects(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tokens := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1")}, "k1")
+	tokens.now = func() time.Time { return now }
+
+	valid, err := tokens.IssueAccess("user-1")
+	require.NoError(t, err)
+
+	forged := newTestTokens(t, map[string][]byte{"k1": []byte("other")}, "k1")
+	forged.now = tokens.now
+	forgedToken, err := forged.IssueAccess("user-1")
+	require.NoError(t, err)
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{Subject: "user-1", Issuer: issuer})
+	noneToken, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	for name, raw := range map[string]string{
+		"garbage":   "not-a-jwt",
+		"forged":    forgedToken,
+		"alg none":  noneToken,
+		"truncated": valid[:len(valid)-4],
+	} {
+		_, err := tokens.ParseAccess(raw)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	now = now.Add(16 * time.Minute)
+	_, err = tokens.ParseAccess(valid)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestNewTokens_UnknownSigningKey(t *testing.T) {
+	_, err := NewTokens(map[string][]byte{"k1": []byte("secret")}, "k2", time.Minute, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+
+	assert.True(t, CheckPassword(hash, "correct horse"))
+	assert.False(t, CheckPassword(hash, "wrong horse"))
+	assert.False(t, CheckPassword("", ""))
+
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+}
+
+func TestRefreshToken(t *testing.T) {
+	token, hash := NewRefreshToken()
+	other, _ := NewRefreshToken()
+
+	assert.NotEqual(t, token, other)
+	assert.Equal(t, hash, HashRefreshToken(token))
+	assert.Len(t, hash, 64)
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1")}, "k1")
+	valid, err := tokens.IssueAccess("user-1")
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 {
+			return
+		}
+		status, kind := http.StatusUnauthorized, apperr.KindOf(c.Errors.Last())
+		if kind == apperr.KindForbidden {
+			status = http.StatusForbidden
+		}
+		c.String(status, string(kind))
+	})
+	r.GET("/me", Middleware(tokens), func(c *gin.Context) {
+		c.String(http.StatusOK, UserID(c))
+	})
+	r.GET("/users/:user_id", Middleware(tokens), RequireSelf("user_id"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{"valid", "/me", "Bearer " + valid, http.StatusOK, "user-1"},
+		{"lowercase scheme", "/me", "bearer " + valid, http.StatusOK, "user-1"},
+		{"missing", "/me", "", http.StatusUnauthorized, "unauthenticated"},
+		{"basic auth", "/me", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "unauthenticated"},
+		{"invalid", "/me", "Bearer nope", http.StatusUnauthorized, "unauthenticated"},
+		{"own user", "/users/user-1", "Bearer " + valid, http.StatusOK, ""},
+		{"other user", "/users/user-2", "Bearer " + valid, http.StatusForbidden, "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+type apiKeyStoreFunc func(ctx context.Context, keyHash string) (models.APIKey, error)
+
+func (f apiKeyStoreFunc) AuthenticateAPIKey(ctx context.Context, keyHash string) (models.APIKey, error) {
+	return f(ctx, keyHash)
+}
+
+func TestMiddlewareWithAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1")}, "k1")
+	access, err := tokens.IssueAccess("user-1")
+	require.NoError(t, err)
+
+	writeKey, writeHash := NewAPIKey()
+	readKey, readHash := NewAPIKey()
+	keys := apiKeyStoreFunc(func(_ context.Context, keyHash string) (models.APIKey, error) {
+		switch keyHash {
+		case writeHash:
+			return models.APIKey{ID: "key-w", StoreID: "store-1", Scopes: []string{models.ScopePurchasesWrite}}, nil
+		case readHash:
+			return models.APIKey{ID: "key-r", StoreID: "store-1", Scopes: []string{models.ScopePurchasesRead}}, nil
+		}
+		return models.APIKey{}, apperr.Unauthenticated("invalid api key")
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 {
+			return
+		}
+		status, kind := http.StatusUnauthorized, apperr.KindOf(c.Errors.Last())
+		if kind == apperr.KindForbidden {
+			status = http.StatusForbidden
+		}
+		c.String(status, string(kind))
+	})
+	whoami := func(c *gin.Context) {
+		if key, ok := APIKey(c); ok {
+			c.String(http.StatusOK, key.ID)
+			return
+		}
+		c.String(http.StatusOK, UserID(c))
+	}
+	r.POST("/purchase", MiddlewareWithAPIKeys(tokens, keys), RequireScope(models.ScopePurchasesWrite), whoami)
+	r.GET("/stores/:store_id/purchases", MiddlewareWithAPIKeys(tokens, keys),
+		RequireScope(models.ScopePurchasesRead), RequireOwnStore("store_id"), whoami)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{"api key header", "POST", "/purchase", map[string]string{APIKeyHeader: writeKey}, http.StatusOK, "key-w"},
+		{"api key scheme", "POST", "/purchase", map[string]string{"Authorization": "ApiKey " + writeKey}, http.StatusOK, "key-w"},
+		{"bearer token", "POST", "/purchase", map[string]string{"Authorization": "Bearer " + access}, http.StatusOK, "user-1"},
+		{"unknown key", "POST", "/purchase", map[string]string{APIKeyHeader: "fk_nope"}, http.StatusUnauthorized, "unauthenticated"},
+		{"missing", "POST", "/purchase", nil, http.StatusUnauthorized, "unauthenticated"},
+		{"missing scope", "POST", "/purchase", map[string]string{APIKeyHeader: readKey}, http.StatusForbidden, "forbidden"},
+		{"own store", "GET", "/stores/store-1/purchases", map[string]string{APIKeyHeader: readKey}, http.StatusOK, "key-r"},
+		{"other store", "GET", "/stores/store-2/purchases", map[string]string{APIKeyHeader: readKey}, http.StatusForbidden, "forbidden"},
+		{"customer on a store", "GET", "/stores/store-1/purchases", map[string]string{"Authorization": "Bearer " + access}, http.StatusForbidden, "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key, hash := NewAPIKey()
+	other, _ := NewAPIKey()
+
+	assert.True(t, strings.HasPrefix(key, "fk_"))
+	assert.NotEqual(t, key, other)
+	assert.Equal(t, hash, HashAPIKey(key))
+}
+
+type roleStoreFunc func(ctx context.Context, userID string) (models.Roles, error)
+
+func (f roleStoreFunc) ListRoles(ctx context.Context, userID string) (models.Roles, error) {
+	return f(ctx, userID)
+}
+
+func TestRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := newTestTokens(t, map[string][]byte{"k1": []byte("secret-1")}, "k1")
+	roles := roleStoreFunc(func(_ context.Context, userID string) (models.Roles, error) {
+		switch userID {
+		case "admin":
+			return models.Roles{{Role: models.RoleAdmin}}, nil
+		case "operator":
+			return models.Roles{{Role: models.RoleStoreOperator, StoreID: "store-1"}}, nil
+		case "broken":
+			return nil, apperr.Unavailable("database unavailable")
+		}
+		return models.Roles{}, nil
+	})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) > 0 {
+			c.String(http.StatusTeapot, string(apperr.KindOf(c.Errors.Last())))
+		}
+	})
+	api := r.Group("", Middleware(tokens), LoadRoles(roles))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	api.GET("/admin", RequireAdmin(), ok)
+	api.GET("/stores/:store_id", RequireOwnStore("store_id"), ok)
+	api.GET("/users/:user_id", RequireSelf("user_id"), ok)
+
+	tests := []struct {
+		user string
+		path string
+		want string
+	}{
+		{"admin", "/admin", "ok"},
+		{"operator", "/admin", "forbidden"},
+		{"customer", "/admin", "forbidden"},
+		{"admin", "/stores/store-1", "ok"},
+		{"operator", "/stores/store-1", "ok"},
+		{"operator", "/stores/store-2", "forbidden"},
+		{"customer", "/stores/store-1", "forbidden"},
+		{"admin", "/users/customer", "ok"},
+		{"operator", "/users/customer", "forbidden"},
+		{"customer", "/users/customer", "ok"},
+		{"broken", "/users/broken", "unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.path, func(t *testing.T) {
+			access, err := tokens.IssueAccess(tt.user)
+			require.NoError(t, err)
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+access)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+)
+
+const userIDKey = "auth.user_id"
+
+// Middleware rejects requests without a valid bearer access token and records
+// the token's user for UserID.
+func Middleware(tokens *Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := authenticateBearer(c, tokens); err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticateBearer(c *gin.Context, tokens *Tokens) error {
+	scheme, raw, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return ErrMissingToken
+	}
+
+	claims, err := tokens.ParseAccess(strings.TrimSpace(raw))
+	if err != nil {
+		return err
+	}
+
+	SetUserID(c, claims.Subject)
+	return nil
+}
+
+// RequireSelf only lets a user through to routes whose param names their own
+// user ID. Admins may act on any user.
+func RequireSelf(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Roles(c).IsAdmin() {
+			c.Next()
+			return
+		}
+		if UserID(c) == "" || c.Param(param) != UserID(c) {
+			c.Error(apperr.Forbidden("cannot access another user's resources"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func SetUserID(c *gin.Context, userID string) {
+	c.Set(userIDKey, userID)
+}
+
+// UserID returns the authenticated user, or "" on routes that are not behind
+// Middleware.
+func UserID(c *gin.Context) string {
+	return c.GetString(userIDKey)
+}
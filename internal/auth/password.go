@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is a bcrypt hash at bcrypt.DefaultCost that no one knows the
+// password of. Checking against it takes as long as checking a real password.
+const dummyHash = "$2a$10$ndptYufMEs5KTAYWUKRWIOalZH7KzbeEYxRPEYR/rN4Fxz.qAzq26"
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash. An empty hash, as
+// stored for users created without a password, never matches, but takes as
+// long to check as any other, so callers can pass one for unknown users too
+// and not give away which usernames exist.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
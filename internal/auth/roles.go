@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+const rolesKey = "auth.roles"
+
+// RoleStore looks up the roles granted to a user.
+type RoleStore interface {
+	ListRoles(ctx context.Context, userID string) (models.Roles, error)
+}
+
+// LoadRoles looks up the roles of the authenticated user for the Require
+// middlewares, so it must run after Middleware. Requests made with a store
+// API key hold no roles.
+func LoadRoles(store RoleStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := UserID(c); userID != "" {
+			roles, err := store.ListRoles(c.Request.Context(), userID)
+			if err != nil {
+				c.Error(err)
+				c.Abort()
+				return
+			}
+			SetRoles(c, roles)
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin only lets admins through.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Roles(c).IsAdmin() {
+			c.Error(apperr.Forbidden("admin role required"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func SetRoles(c *gin.Context, roles models.Roles) {
+	c.Set(rolesKey, roles)
+}
+
+// Roles returns the roles loaded by LoadRoles. Without them a user is only a
+// customer.
+func Roles(c *gin.Context) models.Roles {
+	roles, _ := c.Get(rolesKey)
+	r, _ := roles.(models.Roles)
+	return r
+}
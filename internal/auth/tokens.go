@@ -0,0 +1,127 @@
+// Package auth issues and checks the credentials API callers present: JWT
+// access tokens, opaque refresh tokens, store API keys and bcrypt password
+// hashes.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+)
+
+const issuer = "fetchit"
+
+var (
+	ErrMissingToken = apperr.Unauthenticated("missing access token")
+	ErrInvalidToken = apperr.Unauthenticated("invalid access token")
+	ErrExpiredToken = apperr.Unauthenticated("access token has expired")
+)
+
+// Claims are the contents of an access token. Subject is the user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+}
+
+// Tokens signs access tokens with the key named by signingKID and accepts
+// tokens signed by any key in keys. Rotating a key means adding the new one,
+// switching signingKID to it, and removing the old one once every token it
+// signed has expired.
+type Tokens struct {
+	keys       map[string][]byte
+	signingKID string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+func NewTokens(keys map[string][]byte, signingKID string, accessTTL, refreshTTL time.Duration) (*Tokens, error) {
+	if _, ok := keys[signingKID]; !ok {
+		return nil, fmt.Errorf("signing key %q is not in the key set", signingKID)
+	}
+	return &Tokens{
+		keys:       keys,
+		signingKID: signingKID,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		now:        time.Now,
+	}, nil
+}
+
+// AccessTTL is how long an issued access token stays valid.
+func (t *Tokens) AccessTTL() time.Duration {
+	return t.accessTTL
+}
+
+// RefreshTTL is how long an issued refresh token stays valid.
+func (t *Tokens) RefreshTTL() time.Duration {
+	return t.refreshTTL
+}
+
+func (t *Tokens) IssueAccess(userID string) (string, error) {
+	now := t.now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.accessTTL)),
+		},
+	})
+	token.Header["kid"] = t.signingKID
+	return token.SignedString(t.keys[t.signingKID])
+}
+
+func (t *Tokens) ParseAccess(raw string) (Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(raw, &claims, t.key,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(t.now),
+	)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return Claims{}, ErrExpiredToken
+	case err != nil, claims.Subject == "":
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (t *Tokens) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := t.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// NewRefreshToken returns an opaque refresh token and the hash to store in its
+// place.
+func NewRefreshToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token)
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a random HS256 key for deployments that do not
+// configure one.
+func GenerateKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
@@ -0,0 +1,369 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port              string
+	Database          Database
+	IdempotencyTTL    time.Duration
+	Mail              Mail
+	EmailVerification EmailVerification
+	Auth              Auth
+	Events            Events
+	Webhooks          Webhooks
+	Outbox            Outbox
+	Tracing           Tracing
+	Logging           Logging
+}
+
+type Database struct {
+	URL               string
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	QueryTimeout      time.Duration
+}
+
+// Mail selects how outbound mail is delivered. Driver is "log", which writes
+// messages to LogFile (stderr when empty), or "smtp".
+type Mail struct {
+	Driver       string
+	From         string
+	LogFile      string
+	SMTPHost     string
+	SMTPPort     int32
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// EmailVerification configures the signed links sent to confirm an email
+// address. An empty Secret makes the server generate one at startup, so links
+// stop working after a restart.
+type EmailVerification struct {
+	Secret string
+	TTL    time.Duration
+	URL    string
+}
+
+// Auth configures token signing. Keys maps key IDs to HS256 secrets; tokens
+// are signed with SigningKeyID and accepted from any listed key, so a key can
+// be rotated without logging everyone out. No keys makes the server generate
+// one at startup. AdminUserIDs are granted the admin role at startup, which is
+// how the first admin is created.
+type Auth struct {
+	Keys         map[string][]byte
+	SigningKeyID string
+	AccessTTL    time.Duration
+	RefreshTTL   time.Duration
+	AdminUserIDs []string
+}
+
+// Events configures the in-process sticker event streams and WebSockets.
+// Heartbeat is how often idle streams get a comment and WebSockets a ping.
+// Buffer is how many events a slow client may fall behind by before it is
+// disconnected, History how many recent events are kept for clients that
+// reconnect.
+type Events struct {
+	Heartbeat time.Duration
+	Buffer    int32
+	History   int32
+}
+
+// Webhooks configures webhook delivery. A failed delivery is retried after
+// Backoff, doubling each time, until MaxAttempts have failed and it is
+// dead-lettered. Timeout bounds each request; PollInterval is how often the
+// queue is checked when it is empty.
+type Webhooks struct {
+	MaxAttempts  int32
+	Backoff      time.Duration
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// Outbox configures the relay that publishes sticker events after their
+// purchase commits. Publishers names where they go, in order: "webhooks"
+// queues webhook deliveries, "events" feeds the event streams and WebSockets
+// and "log" writes them to the log. PollInterval is how often the outbox is
+// checked when it is empty and Retention how long sent events are kept.
+type Outbox struct {
+	Publishers   []string
+	PollInterval time.Duration
+	Retention    time.Duration
+}
+
+// Tracing configures OpenTelemetry tracing. Exporter is "none", "stdout",
+// which prints spans for local development, or "otlp", which sends them over
+// HTTP to the collector named by the standard OTEL_EXPORTER_OTLP_* variables.
+// SampleRatio is the share of new traces recorded; requests that arrive with a
+// traceparent follow the caller's decision.
+type Tracing struct {
+	Exporter    string
+	SampleRatio float64
+}
+
+// Logging configures the server's log. Format is "json", one object per line,
+// or "text" for reading locally; lines below Level are dropped.
+type Logging struct {
+	Level  slog.Level
+	Format string
+}
+
+// Load reads the configuration from the environment, falling back to defaults
+// for anything that is not set.
+func Load() (Config, error) {
+	var cfg Config
+	var err error
+
+	cfg.Port = getString("PORT", "8080")
+
+	cfg.Database.URL = getString("DATABASE_URL", "")
+	if cfg.Database.MaxConns, err = getInt32("DB_MAX_CONNS", 10); err != nil {
+		return Config{}, err
+	}
+	if cfg.Database.MinConns, err = getInt32("DB_MIN_CONNS", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.Database.MaxConnLifetime, err = getDuration("DB_MAX_CONN_LIFETIME", time.Hour); err != nil {
+		return Config{}, err
+	}
+	if cfg.Database.MaxConnIdleTime, err = getDuration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.Database.HealthCheckPeriod, err = getDuration("DB_HEALTH_CHECK_PERIOD", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.Database.QueryTimeout, err = getDuration("DB_QUERY_TIMEOUT", 5*time.Second); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.IdempotencyTTL, err = getDuration("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Mail.Driver = getString("MAIL_DRIVER", "log")
+	cfg.Mail.From = getString("MAIL_FROM", "no-reply@fetchit.local")
+	cfg.Mail.LogFile = getString("MAIL_LOG_FILE", "")
+	cfg.Mail.SMTPHost = getString("SMTP_HOST", "")
+	if cfg.Mail.SMTPPort, err = getInt32("SMTP_PORT", 587); err != nil {
+		return Config{}, err
+	}
+	cfg.Mail.SMTPUsername = getString("SMTP_USERNAME", "")
+	cfg.Mail.SMTPPassword = getString("SMTP_PASSWORD", "")
+
+	cfg.EmailVerification.Secret = getString("EMAIL_VERIFICATION_SECRET", "")
+	if cfg.EmailVerification.TTL, err = getDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	cfg.EmailVerification.URL = getString("EMAIL_VERIFICATION_URL", "http://localhost:"+cfg.Port+"/api/verify-email")
+
+	if cfg.Auth.Keys, err = getKeys("JWT_KEYS"); err != nil {
+		return Config{}, err
+	}
+	cfg.Auth.SigningKeyID = getString("JWT_SIGNING_KEY_ID", "")
+	if cfg.Auth.SigningKeyID == "" && len(cfg.Auth.Keys) == 1 {
+		for kid := range cfg.Auth.Keys {
+			cfg.Auth.SigningKeyID = kid
+		}
+	}
+	if cfg.Auth.AccessTTL, err = getDuration("JWT_ACCESS_TTL", 15*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.Auth.RefreshTTL, err = getDuration("JWT_REFRESH_TTL", 30*24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	cfg.Auth.AdminUserIDs = getList("ADMIN_USER_IDS")
+
+	if cfg.Events.Heartbeat, err = getDuration("EVENTS_HEARTBEAT", 15*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.Events.Buffer, err = getInt32("EVENTS_BUFFER", 64); err != nil {
+		return Config{}, err
+	}
+	if cfg.Events.History, err = getInt32("EVENTS_HISTORY", 1024); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Webhooks.MaxAttempts, err = getInt32("WEBHOOK_MAX_ATTEMPTS", 8); err != nil {
+		return Config{}, err
+	}
+	if cfg.Webhooks.Backoff, err = getDuration("WEBHOOK_BACKOFF", 30*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.Webhooks.Timeout, err = getDuration("WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.Webhooks.PollInterval, err = getDuration("WEBHOOK_POLL_INTERVAL", time.Second); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Outbox.Publishers = getList("OUTBOX_PUBLISHERS")
+	if len(cfg.Outbox.Publishers) == 0 {
+		cfg.Outbox.Publishers = []string{"webhooks", "events"}
+	}
+	if cfg.Outbox.PollInterval, err = getDuration("OUTBOX_POLL_INTERVAL", 500*time.Millisecond); err != nil {
+		return Config{}, err
+	}
+	if cfg.Outbox.Retention, err = getDuration("OUTBOX_RETENTION", 7*24*time.Hour); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Tracing.Exporter = getString("TRACING_EXPORTER", "none")
+	if cfg.Tracing.SampleRatio, err = getFloat("TRACING_SAMPLE_RATIO", 1); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Logging.Level.UnmarshalText([]byte(getString("LOG_LEVEL", "info"))); err != nil {
+		return Config{}, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	cfg.Logging.Format = getString("LOG_FORMAT", "json")
+
+	if cfg.Database.MaxConns < 1 {
+		return Config{}, fmt.Errorf("DB_MAX_CONNS must be at least 1, got %d", cfg.Database.MaxConns)
+	}
+	if cfg.Database.MinConns < 0 || cfg.Database.MinConns > cfg.Database.MaxConns {
+		return Config{}, fmt.Errorf("DB_MIN_CONNS must be between 0 and DB_MAX_CONNS, got %d", cfg.Database.MinConns)
+	}
+
+	switch cfg.Mail.Driver {
+	case "log":
+	case "smtp":
+		if cfg.Mail.SMTPHost == "" {
+			return Config{}, fmt.Errorf("SMTP_HOST is required when MAIL_DRIVER is smtp")
+		}
+	default:
+		return Config{}, fmt.Errorf("MAIL_DRIVER must be log or smtp, got %q", cfg.Mail.Driver)
+	}
+	if cfg.EmailVerification.TTL == 0 {
+		return Config{}, fmt.Errorf("EMAIL_VERIFICATION_TTL must be positive")
+	}
+
+	if len(cfg.Auth.Keys) > 0 {
+		if _, ok := cfg.Auth.Keys[cfg.Auth.SigningKeyID]; !ok {
+			return Config{}, fmt.Errorf("JWT_SIGNING_KEY_ID must name one of the JWT_KEYS, got %q", cfg.Auth.SigningKeyID)
+		}
+	}
+	if cfg.Auth.AccessTTL == 0 || cfg.Auth.RefreshTTL == 0 {
+		return Config{}, fmt.Errorf("JWT_ACCESS_TTL and JWT_REFRESH_TTL must be positive")
+	}
+	if cfg.Events.Heartbeat == 0 {
+		return Config{}, fmt.Errorf("EVENTS_HEARTBEAT must be positive")
+	}
+	if cfg.Events.Buffer < 1 || cfg.Events.History < 0 {
+		return Config{}, fmt.Errorf("EVENTS_BUFFER must be at least 1 and EVENTS_HISTORY not negative")
+	}
+	if cfg.Webhooks.MaxAttempts < 1 {
+		return Config{}, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1, got %d", cfg.Webhooks.MaxAttempts)
+	}
+	if cfg.Webhooks.Backoff == 0 || cfg.Webhooks.Timeout == 0 || cfg.Webhooks.PollInterval == 0 {
+		return Config{}, fmt.Errorf("WEBHOOK_BACKOFF, WEBHOOK_TIMEOUT and WEBHOOK_POLL_INTERVAL must be positive")
+	}
+	for _, publisher := range cfg.Outbox.Publishers {
+		switch publisher {
+		case "webhooks", "events", "log":
+		default:
+			return Config{}, fmt.Errorf("OUTBOX_PUBLISHERS must list webhooks, events or log, got %q", publisher)
+		}
+	}
+	if cfg.Outbox.PollInterval == 0 {
+		return Config{}, fmt.Errorf("OUTBOX_POLL_INTERVAL must be positive")
+	}
+	if cfg.Outbox.Retention == 0 {
+		return Config{}, fmt.Errorf("OUTBOX_RETENTION must be positive")
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		return Config{}, fmt.Errorf("TRACING_EXPORTER must be none, stdout or otlp, got %q", cfg.Tracing.Exporter)
+	}
+	if cfg.Logging.Format != "json" && cfg.Logging.Format != "text" {
+		return Config{}, fmt.Errorf("LOG_FORMAT must be json or text, got %q", cfg.Logging.Format)
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return Config{}, fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1, got %g", cfg.Tracing.SampleRatio)
+	}
+
+	return cfg, nil
+}
+
+func getString(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getInt32(key string, fallback int32) (int32, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return int32(n), nil
+}
+
+func getFloat(key string, fallback float64) (float64, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return f, nil
+}
+
+func getDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must not be negative", key, v)
+	}
+	return d, nil
+}
+
+// getList parses a comma-separated list, dropping empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// getKeys parses a comma-separated list of kid:secret pairs.
+func getKeys(key string) (map[string][]byte, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil, nil
+	}
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(v, ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid %s: want kid:secret pairs separated by commas", key)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
@@ -0,0 +1,147 @@
+package config_test
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/fetchit")
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, "postgres://localhost/fetchit", cfg.Database.URL)
+	assert.Equal(t, int32(10), cfg.Database.MaxConns)
+	assert.Equal(t, int32(0), cfg.Database.MinConns)
+	assert.Equal(t, time.Hour, cfg.Database.MaxConnLifetime)
+	assert.Equal(t, 30*time.Minute, cfg.Database.MaxConnIdleTime)
+	assert.Equal(t, time.Minute, cfg.Database.HealthCheckPeriod)
+	assert.Equal(t, 5*time.Second, cfg.Database.QueryTimeout)
+	assert.Equal(t, 24*time.Hour, cfg.IdempotencyTTL)
+	assert.Equal(t, "log", cfg.Mail.Driver)
+	assert.Equal(t, int32(587), cfg.Mail.SMTPPort)
+	assert.Equal(t, 24*time.Hour, cfg.EmailVerification.TTL)
+	assert.Equal(t, "http://localhost:8080/api/verify-email", cfg.EmailVerification.URL)
+	assert.Empty(t, cfg.Auth.Keys)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.AccessTTL)
+	assert.Equal(t, 30*24*time.Hour, cfg.Auth.RefreshTTL)
+	assert.Empty(t, cfg.Auth.AdminUserIDs)
+	assert.Equal(t, 15*time.Second, cfg.Events.Heartbeat)
+	assert.Equal(t, int32(64), cfg.Events.Buffer)
+	assert.Equal(t, int32(1024), cfg.Events.History)
+	assert.Equal(t, int32(8), cfg.Webhooks.MaxAttempts)
+	assert.Equal(t, 30*time.Second, cfg.Webhooks.Backoff)
+	assert.Equal(t, 10*time.Second, cfg.Webhooks.Timeout)
+	assert.Equal(t, time.Second, cfg.Webhooks.PollInterval)
+	assert.Equal(t, []string{"webhooks", "events"}, cfg.Outbox.Publishers)
+	assert.Equal(t, 500*time.Millisecond, cfg.Outbox.PollInterval)
+	assert.Equal(t, 7*24*time.Hour, cfg.Outbox.Retention)
+	assert.Equal(t, "none", cfg.Tracing.Exporter)
+	assert.Equal(t, 1.0, cfg.Tracing.SampleRatio)
+	assert.Equal(t, slog.LevelInfo, cfg.Logging.Level)
+	assert.Equal(t, "json", cfg.Logging.Format)
+}
+
+func TestLoad_Overrides(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("DB_MAX_CONNS", "25")
+	t.Setenv("DB_MIN_CONNS", "5")
+	t.Setenv("DB_MAX_CONN_LIFETIME", "2h")
+	t.Setenv("DB_MAX_CONN_IDLE_TIME", "10m")
+	t.Setenv("DB_HEALTH_CHECK_PERIOD", "30s")
+	t.Setenv("DB_QUERY_TIMEOUT", "750ms")
+	t.Setenv("IDEMPOTENCY_TTL", "48h")
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "2525")
+	t.Setenv("EMAIL_VERIFICATION_TTL", "2h")
+	t.Setenv("JWT_KEYS", "2025-01:old-secret, 2025-06:new-secret")
+	t.Setenv("JWT_SIGNING_KEY_ID", "2025-06")
+	t.Setenv("JWT_ACCESS_TTL", "5m")
+	t.Setenv("ADMIN_USER_IDS", "4f1c2b8e-6a8d-4c0e-9d1a-2f6b7e3c9a10, ,0d6f3a52-7b1e-4c9a-a2f4-5e8b9c1d7a36")
+	t.Setenv("OUTBOX_PUBLISHERS", "log, events")
+	t.Setenv("OUTBOX_RETENTION", "24h")
+	t.Setenv("TRACING_EXPORTER", "otlp")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "text")
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "9090", cfg.Port)
+	assert.Equal(t, int32(25), cfg.Database.MaxConns)
+	assert.Equal(t, int32(5), cfg.Database.MinConns)
+	assert.Equal(t, 2*time.Hour, cfg.Database.MaxConnLifetime)
+	assert.Equal(t, 10*time.Minute, cfg.Database.MaxConnIdleTime)
+	assert.Equal(t, 30*time.Second, cfg.Database.HealthCheckPeriod)
+	assert.Equal(t, 750*time.Millisecond, cfg.Database.QueryTimeout)
+	assert.Equal(t, 48*time.Hour, cfg.IdempotencyTTL)
+	assert.Equal(t, "smtp", cfg.Mail.Driver)
+	assert.Equal(t, "smtp.example.com", cfg.Mail.SMTPHost)
+	assert.Equal(t, int32(2525), cfg.Mail.SMTPPort)
+	assert.Equal(t, 2*time.Hour, cfg.EmailVerification.TTL)
+	assert.Equal(t, "http://localhost:9090/api/verify-email", cfg.EmailVerification.URL)
+	assert.Equal(t, map[string][]byte{"2025-01": []byte("old-secret"), "2025-06": []byte("new-secret")}, cfg.Auth.Keys)
+	assert.Equal(t, "2025-06", cfg.Auth.SigningKeyID)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.AccessTTL)
+	assert.Equal(t, []string{"4f1c2b8e-6a8d-4c0e-9d1a-2f6b7e3c9a10", "0d6f3a52-7b1e-4c9a-a2f4-5e8b9c1d7a36"}, cfg.Auth.AdminUserIDs)
+	assert.Equal(t, []string{"log", "events"}, cfg.Outbox.Publishers)
+	assert.Equal(t, 24*time.Hour, cfg.Outbox.Retention)
+	assert.Equal(t, "otlp", cfg.Tracing.Exporter)
+	assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+	assert.Equal(t, slog.LevelDebug, cfg.Logging.Level)
+	assert.Equal(t, "text", cfg.Logging.Format)
+}
+
+func TestLoad_SingleJWTKeySigns(t *testing.T) {
+	t.Setenv("JWT_KEYS", "only:secret")
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "only", cfg.Auth.SigningKeyID)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"non-numeric max conns", "DB_MAX_CONNS", "lots"},
+		{"zero max conns", "DB_MAX_CONNS", "0"},
+		{"min conns above max", "DB_MIN_CONNS", "50"},
+		{"negative min conns", "DB_MIN_CONNS", "-1"},
+		{"bad duration", "DB_QUERY_TIMEOUT", "5 seconds"},
+		{"negative duration", "DB_MAX_CONN_LIFETIME", "-1m"},
+		{"unknown mail driver", "MAIL_DRIVER", "pigeon"},
+		{"smtp without host", "MAIL_DRIVER", "smtp"},
+		{"zero verification ttl", "EMAIL_VERIFICATION_TTL", "0s"},
+		{"malformed jwt keys", "JWT_KEYS", "no-secret"},
+		{"ambiguous signing key", "JWT_KEYS", "a:one,b:two"},
+		{"zero access ttl", "JWT_ACCESS_TTL", "0s"},
+		{"unknown outbox publisher", "OUTBOX_PUBLISHERS", "events,kafka"},
+		{"zero outbox poll interval", "OUTBOX_POLL_INTERVAL", "0s"},
+		{"zero outbox retention", "OUTBOX_RETENTION", "0s"},
+		{"unknown tracing exporter", "TRACING_EXPORTER", "jaeger"},
+		{"sample ratio above one", "TRACING_SAMPLE_RATIO", "1.5"},
+		{"non-numeric sample ratio", "TRACING_SAMPLE_RATIO", "half"},
+		{"unknown log level", "LOG_LEVEL", "verbose"},
+		{"unknown log format", "LOG_FORMAT", "xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := config.Load()
+			assert.Error(t, err)
+		})
+	}
+}
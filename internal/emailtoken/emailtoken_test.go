@@ -0,0 +1,60 @@
+package emailtoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner_RoundTrip(t *testing.T) {
+	s := New([]byte("secret"), time.Hour)
+
+	token, err := s.Issue("user-1", "tester@example.com")
+	require.NoError(t, err)
+
+	claims, err := s.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.Equal(t, "tester@example.com", claims.Email)
+}
+
+func TestSigner_Expired(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	s := New([]byte("secret"), time.Hour)
+	s.now = func() time.Time { return now }
+
+	token, err := s.Issue("user-1", "tester@example.com")
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	_, err = s.Parse(token)
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestSigner_Invalid(t *testing.T) {
+	s := New([]byte("secret"), time.Hour)
+	token, err := s.Issue("user-1", "tester@example.com")
+	require.NoError(t, err)
+	payload, sig, _ := strings.Cut(token, ".")
+
+	other, err := New([]byte("other"), time.Hour).Issue("user-1", "tester@example.com")
+	require.NoError(t, err)
+	victim, err := s.Issue("user-2", "victim@example.com")
+	require.NoError(t, err)
+	forged, _, _ := strings.Cut(victim, ".")
+
+	for name, tok := range map[string]string{
+		"empty":          "",
+		"no signature":   payload,
+		"bad signature":  payload + ".AAAA",
+		"other secret":   other,
+		"swapped claims": forged + "." + sig,
+		"garbage":        "not.base64!",
+	} {
+		_, err := s.Parse(tok)
+		assert.ErrorIs(t, err, ErrInvalid, name)
+	}
+}
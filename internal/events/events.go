@@ -0,0 +1,205 @@
+// Package events fans sticker events out to the clients listening for them
+// inside this process.
+package events
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBuffer  = 64
+	defaultHistory = 1024
+)
+
+// Topic names what a subscriber listens to: a user's or a store's events.
+type Topic string
+
+func User(userID string) Topic {
+	return Topic("user:" + userID)
+}
+
+func Store(storeID string) Topic {
+	return Topic("store:" + storeID)
+}
+
+// Split returns the kind ("user" or "store") and ID of a topic.
+func (t Topic) Split() (kind, id string) {
+	kind, id, _ = strings.Cut(string(t), ":")
+	return kind, id
+}
+
+// Event is something that happened, published on every topic it concerns.
+// IDs increase with every event published on a Bus, so a client can resume
+// after the last one it saw.
+type Event struct {
+	ID     uint64
+	Type   string
+	Topics []Topic
+	Time   time.Time
+	Data   any
+}
+
+// Bus delivers published events to the subscribers of the event's topics. It
+// keeps the most recent events so a subscriber that reconnects can catch up
+// on what it missed.
+//
+// Events live in memory only: they are lost on restart and not shared
+// between instances. IDs start from the startup time so they keep increasing
+// across restarts and a stale Last-Event-ID never hides new events.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event
+	next    int
+	subs    map[Topic]map[*Subscription]struct{}
+	closed  bool
+	buffer  int
+	now     func() time.Time
+}
+
+type Option func(*Bus)
+
+// WithBuffer sets how many undelivered events a subscriber may fall behind by
+// before it is dropped.
+func WithBuffer(n int) Option {
+	return func(b *Bus) {
+		b.buffer = n
+	}
+}
+
+// WithHistory sets how many recent events, across all topics, are kept for
+// subscribers that resume.
+func WithHistory(n int) Option {
+	return func(b *Bus) {
+		b.history = make([]Event, 0, n)
+	}
+}
+
+func New(opts ...Option) *Bus {
+	b := &Bus{
+		history: make([]Event, 0, defaultHistory),
+		subs:    make(map[Topic]map[*Subscription]struct{}),
+		buffer:  defaultBuffer,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.lastID = uint64(b.now().UnixMicro())
+	return b
+}
+
+// Subscription receives the events of one topic until it is closed, either by
+// the subscriber, by the bus shutting down, or because the subscriber fell a
+// full buffer behind.
+type Subscription struct {
+	bus   *Bus
+	topic Topic
+	ch    chan Event
+}
+
+// Events is closed when the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close stops delivery. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Publish records an event and hands it to the subscribers of its topics. It
+// never blocks: a subscriber whose buffer is full is dropped and has to
+// resubscribe.
+func (b *Bus) Publish(typ string, data any, topics ...Topic) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := Event{ID: b.lastID, Type: typ, Topics: topics, Time: b.now(), Data: data}
+	if b.closed {
+		return e
+	}
+
+	if cap(b.history) > 0 {
+		if len(b.history) < cap(b.history) {
+			b.history = append(b.history, e)
+		} else {
+			b.history[b.next] = e
+			b.next = (b.next + 1) % len(b.history)
+		}
+	}
+
+	for _, topic := range topics {
+		for s := range b.subs[topic] {
+			select {
+			case s.ch <- e:
+			default:
+				b.remove(s)
+			}
+		}
+	}
+	return e
+}
+
+// Subscribe starts delivering a topic's events. The retained events published
+// after afterID are returned rather than queued, so a long backlog does not
+// count against the buffer; afterID 0 skips the backlog. The subscription of
+// a closed bus is already closed.
+func (b *Bus) Subscribe(topic Topic, afterID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{bus: b, topic: topic, ch: make(chan Event, b.buffer)}
+	if b.closed {
+		close(s.ch)
+		return s, nil
+	}
+
+	var backlog []Event
+	if afterID > 0 {
+		for i := range b.history {
+			e := b.history[(b.next+i)%len(b.history)]
+			if e.ID > afterID && slices.Contains(e.Topics, topic) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	if b.subs[topic] == nil {
+		b.subs[topic] = make(map[*Subscription]struct{})
+	}
+	b.subs[topic][s] = struct{}{}
+	return s, backlog
+}
+
+// Close ends every subscription, and any later ones, so that streaming
+// requests finish during a graceful shutdown.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, subs := range b.subs {
+		for s := range subs {
+			b.remove(s)
+		}
+	}
+}
+
+func (b *Bus) remove(s *Subscription) {
+	subs := b.subs[s.topic]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(b.subs, s.topic)
+	}
+	close(s.ch)
+}
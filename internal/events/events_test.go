@@ -0,0 +1,118 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-s.Events():
+		require.True(t, ok, "subscription closed")
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+		return Event{}
+	}
+}
+
+func TestBus_DeliversToTopicSubscribers(t *testing.T) {
+	b := New()
+	alice, _ := b.Subscribe(User("alice"), 0)
+	defer alice.Close()
+	bob, _ := b.Subscribe(User("bob"), 0)
+	defer bob.Close()
+	store, _ := b.Subscribe(Store("corner-shop"), 0)
+	defer store.Close()
+
+	sent := b.Publish("star_awarded", 1, User("alice"), Store("corner-shop"))
+
+	got := receive(t, alice)
+	assert.Equal(t, sent, got)
+	assert.Equal(t, "star_awarded", got.Type)
+	assert.Equal(t, sent, receive(t, store))
+	assert.Len(t, bob.Events(), 0)
+}
+
+func TestTopic_Split(t *testing.T) {
+	kind, id := Store("corner-shop").Split()
+	assert.Equal(t, "store", kind)
+	assert.Equal(t, "corner-shop", id)
+}
+
+func TestBus_IDsIncrease(t *testing.T) {
+	b := New()
+	first := b.Publish("star_awarded", nil, User("alice"))
+	second := b.Publish("star_awarded", nil, User("bob"))
+	assert.Greater(t, second.ID, first.ID)
+
+	// A restarted bus starts above the IDs its predecessor handed out.
+	time.Sleep(time.Millisecond)
+	assert.Greater(t, New().Publish("star_awarded", nil, User("alice")).ID, second.ID)
+}
+
+func TestBus_SubscribeReturnsBacklogAfterID(t *testing.T) {
+	b := New()
+	first := b.Publish("star_awarded", 1, User("alice"))
+	b.Publish("star_awarded", 2, User("bob"))
+	second := b.Publish("level_up", 3, User("alice"))
+
+	s, backlog := b.Subscribe(User("alice"), first.ID)
+	defer s.Close()
+	assert.Equal(t, []Event{second}, backlog)
+
+	s2, backlog := b.Subscribe(User("alice"), 0)
+	defer s2.Close()
+	assert.Empty(t, backlog)
+}
+
+func TestBus_HistoryIsBounded(t *testing.T) {
+	b := New(WithHistory(2))
+	first := b.Publish("star_awarded", 1, User("alice"))
+	b.Publish("star_awarded", 2, User("alice"))
+	b.Publish("star_awarded", 3, User("alice"))
+	last := b.Publish("star_awarded", 4, User("alice"))
+
+	s, backlog := b.Subscribe(User("alice"), first.ID)
+	defer s.Close()
+	require.Len(t, backlog, 2)
+	assert.Equal(t, 3, backlog[0].Data)
+	assert.Equal(t, last, backlog[1])
+}
+
+func TestBus_DropsSlowSubscribers(t *testing.T) {
+	b := New(WithBuffer(1))
+	slow, _ := b.Subscribe(User("alice"), 0)
+	fast, _ := b.Subscribe(User("alice"), 0)
+
+	b.Publish("star_awarded", 1, User("alice"))
+	receive(t, fast)
+	b.Publish("star_awarded", 2, User("alice"))
+
+	assert.Equal(t, 1, receive(t, slow).Data)
+	_, ok := <-slow.Events()
+	assert.False(t, ok, "slow subscriber should be dropped")
+	assert.Equal(t, 2, receive(t, fast).Data)
+
+	fast.Close()
+	fast.Close()
+}
+
+func TestBus_CloseEndsSubscriptions(t *testing.T) {
+	b := New()
+	s, _ := b.Subscribe(User("alice"), 0)
+
+	b.Close()
+	_, ok := <-s.Events()
+	assert.False(t, ok)
+
+	late, backlog := b.Subscribe(User("alice"), 1)
+	_, ok = <-late.Events()
+	assert.False(t, ok)
+	assert.Empty(t, backlog)
+	s.Close()
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary Rebuild sticker progress from the purchase ledger
+// @Description Recompute sticker progress for one user, one store or everything using the current level rules.
+// @Description With dry_run set the differences are reported but not written.
+// @Description Stickers with no purchases in the ledger, e.g. earned before it existed, are reported with
+// @Description no_ledger_history and kept unless delete_without_history is set.
+// @Description Admins only.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param replay body models.ReplayRequest true "Replay scope"
+// @Success 200 {object} models.ReplayReport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/admin/replay [post]
+func (h *Handler) ReplayProgress(c *gin.Context) {
+	var req models.ReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.ReplayProgress(c.Request.Context(), req)
+	if err != nil {
+		c.Error(err).SetMeta("failed to replay sticker progress")
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "sticker progress replayed",
+		"user_id", req.UserID, "store_id", req.StoreID, "dry_run", resp.DryRun,
+		"scanned", resp.Scanned, "changed", resp.Changed)
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary Issue a store API key
+// @Description Create a key that the store's point-of-sale terminals send in the X-API-Key header.
+// @Description The key is only returned by this call; just a hash of it is kept. Scopes defaults to purchases:write.
+// @Description Only the store's operators and admins may manage its keys.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param key body models.APIKeyRequest true "Key name and scopes"
+// @Success 201 {object} models.APIKeyResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/api-keys [post]
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	raw, hash := auth.NewAPIKey()
+	key, err := h.repository.CreateAPIKey(c.Request.Context(), uri.StoreID, req, hash)
+	if err != nil {
+		c.Error(err).SetMeta("failed to create api key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIKeyResponse{APIKey: key, Key: raw})
+}
+
+// @Summary List a store's API keys
+// @Description List every key issued for a store, revoked ones included, oldest first
+// @Tags API Keys
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Success 200 {object} models.APIKeyListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/api-keys [get]
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.ListAPIKeys(c.Request.Context(), uri.StoreID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list api keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Revoke a store API key
+// @Description Stop a key from authenticating. Purchases it recorded keep their source.
+// @Tags API Keys
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param key_id path string true "Key ID" format(uuid)
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/api-keys/{key_id} [delete]
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	var uri apiKeyURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	if err := h.repository.RevokeAPIKey(c.Request.Context(), uri.StoreID, uri.KeyID); err != nil {
+		c.Error(err).SetMeta("failed to revoke api key")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+var errInvalidCredentials = apperr.Unauthenticated("invalid username or password")
+
+// @Summary Sign up
+// @Description Create a user with a password and log them in. When an email is
+// @Description given, a verification link is sent to it.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param signup body models.SignupRequest true "Account details"
+// @Success 201 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/auth/signup [post]
+func (h *Handler) Signup(c *gin.Context) {
+	var req models.SignupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.Error(err).SetMeta("failed to create account")
+		return
+	}
+
+	user, err := h.repository.CreateAccount(c.Request.Context(), req, hash)
+	if err != nil {
+		c.Error(err).SetMeta("failed to create account")
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "account created", "user_id", user.ID, "username", req.Username)
+
+	if user.Email != "" {
+		h.trySendVerification(c.Request.Context(), user.ID, user.Email)
+	}
+
+	resp, err := h.issueTokens(c.Request.Context(), user.ID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to issue tokens")
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary Log in
+// @Description Exchange a username and password for an access and refresh token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param login body models.LoginRequest true "Credentials"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/auth/login [post]
+func (h *Handler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	creds, err := h.repository.GetCredentials(c.Request.Context(), req.Username)
+	if apperr.Is(err, apperr.KindNotFound) {
+		// Spend as long as a wrong password would, so unknown usernames
+		// cannot be told apart by how fast they fail.
+		auth.CheckPassword("", req.Password)
+		slog.WarnContext(c.Request.Context(), "login failed: unknown user", "username", req.Username)
+		c.Error(errInvalidCredentials)
+		return
+	}
+	if err != nil {
+		c.Error(err).SetMeta("failed to log in")
+		return
+	}
+	if !auth.CheckPassword(creds.PasswordHash, req.Password) {
+		slog.WarnContext(c.Request.Context(), "login failed: wrong password", "user_id", creds.UserID)
+		c.Error(errInvalidCredentials)
+		return
+	}
+
+	resp, err := h.issueTokens(c.Request.Context(), creds.UserID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to issue tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access and refresh token.
+// @Description The old refresh token stops working.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/auth/refresh [post]
+func (h *Handler) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	refresh, hash := auth.NewRefreshToken()
+	userID, err := h.repository.RotateRefreshToken(c.Request.Context(),
+		auth.HashRefreshToken(req.RefreshToken), hash, h.tokens.RefreshTTL())
+	if err != nil {
+		c.Error(err).SetMeta("failed to refresh tokens")
+		return
+	}
+
+	access, err := h.tokens.IssueAccess(userID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to issue tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.tokenResponse(userID, access, refresh))
+}
+
+// @Summary Log out
+// @Description Revoke a refresh token. Access tokens stay valid until they expire.
+// @Tags Auth
+// @Accept json
+// @Param refresh body models.RefreshRequest true "Refresh token"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/auth/logout [post]
+func (h *Handler) Logout(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	if err := h.repository.RevokeRefreshToken(c.Request.Context(), auth.HashRefreshToken(req.RefreshToken)); err != nil {
+		c.Error(err).SetMeta("failed to log out")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) issueTokens(ctx context.Context, userID string) (models.TokenResponse, error) {
+	access, err := h.tokens.IssueAccess(userID)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	refresh, hash := auth.NewRefreshToken()
+	if err := h.repository.CreateRefreshToken(ctx, userID, hash, h.tokens.RefreshTTL()); err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	return h.tokenResponse(userID, access, refresh), nil
+}
+
+func (h *Handler) tokenResponse(userID, access, refresh string) models.TokenResponse {
+	return models.TokenResponse{
+		UserID:       userID,
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.tokens.AccessTTL().Seconds()),
+		RefreshToken: refresh,
+	}
+}
+
+// actingUser returns the authenticated caller, failing on routes that are
+// not behind auth.Middleware.
+func actingUser(c *gin.Context) (string, error) {
+	userID := auth.UserID(c)
+	if userID == "" {
+		return "", auth.ErrMissingToken
+	}
+	return userID, nil
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/mailer"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary Change a user's email
+// @Description Replace the user's email and send a verification link to the new address.
+// @Description The email stays unverified until the link is used.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID" format(uuid)
+// @Param email body models.EmailRequest true "New email"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users/{user_id}/email [put]
+func (h *Handler) UpdateEmail(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.UpdateEmail(c.Request.Context(), uri.UserID, req.Email)
+	if err != nil {
+		c.Error(err).SetMeta("failed to update email")
+		return
+	}
+
+	if err := h.sendVerification(c.Request.Context(), resp.ID, resp.Email); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Verify an email address
+// @Description Confirm the email a verification token was issued for. The token
+// @Description can be passed as a query parameter (links) or in a JSON body.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param token query string false "Verification token"
+// @Param body body models.VerifyEmailRequest false "Verification token"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/verify-email [post]
+// @Router /api/verify-email [get]
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	claims, err := h.emailTokens.Parse(req.Token)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := h.repository.VerifyEmail(c.Request.Context(), claims.UserID, claims.Email)
+	if err != nil {
+		c.Error(err).SetMeta("failed to verify email")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// trySendVerification sends a verification link for an account that has just
+// been created. The account exists whether or not the mail goes out, so a
+// failure is only logged; PUT /api/users/{user_id}/email sends a new link.
+func (h *Handler) trySendVerification(ctx context.Context, userID, email string) {
+	if err := h.sendVerification(ctx, userID, email); err != nil {
+		slog.ErrorContext(ctx, "sending verification email failed", "user_id", userID, "error", err)
+	}
+}
+
+func (h *Handler) sendVerification(ctx context.Context, userID, email string) error {
+	token, err := h.emailTokens.Issue(userID, email)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(h.verifyURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	err = h.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your FetchIt email address",
+		Body:    fmt.Sprintf("Open this link to confirm your email address:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n", link),
+	})
+	if err != nil {
+		return apperr.Wrap(apperr.KindUnavailable, "failed to send verification email", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+var statusByKind = map[apperr.Kind]int{
+	apperr.KindNotFound:        http.StatusNotFound,
+	apperr.KindConflict:        http.StatusConflict,
+	apperr.KindValidation:      http.StatusBadRequest,
+	apperr.KindUnprocessable:   http.StatusUnprocessableEntity,
+	apperr.KindUnavailable:     http.StatusServiceUnavailable,
+	apperr.KindUnauthenticated: http.StatusUnauthorized,
+	apperr.KindForbidden:       http.StatusForbidden,
+}
+
+// ErrorHandler renders the last error a handler attached with c.Error as a
+// models.ErrorResponse. Domain errors keep their message and get the status of
+// their kind; anything else is a 500 whose message is the error's meta string,
+// so internal details never reach the client. Those are logged instead.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		status, resp := errorResponse(c.Errors.Last())
+		if status >= http.StatusInternalServerError {
+			slog.ErrorContext(c.Request.Context(), resp.Error, "error", c.Errors.Last().Err)
+		}
+		if status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", "Bearer")
+		}
+		c.AbortWithStatusJSON(status, resp)
+	}
+}
+
+func errorResponse(ginErr *gin.Error) (int, models.ErrorResponse) {
+	var domainErr *apperr.Error
+	if errors.As(ginErr.Err, &domainErr) {
+		if status, ok := statusByKind[domainErr.Kind]; ok {
+			return status, models.ErrorResponse{
+				Error:   domainErr.Message,
+				Code:    string(domainErr.Kind),
+				Details: domainErr.Fields,
+			}
+		}
+	}
+
+	message, ok := ginErr.Meta.(string)
+	if !ok {
+		message = "internal server error"
+	}
+	return http.StatusInternalServerError, models.ErrorResponse{Error: message, Code: string(apperr.KindInternal)}
+}
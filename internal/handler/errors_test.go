@@ -0,0 +1,104 @@
+package handler_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		err      error
+		meta     any
+		wantCode int
+		wantBody string
+	}{
+		{"not found", apperr.NotFound("user not found"), nil,
+			http.StatusNotFound, `{"error":"user not found","code":"not_found"}`},
+		{"conflict", apperr.Conflict("resource already exists"), nil,
+			http.StatusConflict, `{"error":"resource already exists","code":"conflict"}`},
+		{"validation", apperr.Validation("invalid request"), nil,
+			http.StatusBadRequest, `{"error":"invalid request","code":"validation"}`},
+		{"unprocessable", apperr.Unprocessable("key reused"), nil,
+			http.StatusUnprocessableEntity, `{"error":"key reused","code":"unprocessable"}`},
+		{"unavailable", apperr.Wrap(apperr.KindUnavailable, "database unavailable", errors.New("dial tcp: refused")), nil,
+			http.StatusServiceUnavailable, `{"error":"database unavailable","code":"unavailable"}`},
+		{"unauthenticated", apperr.Unauthenticated("missing access token"), nil,
+			http.StatusUnauthorized, `{"error":"missing access token","code":"unauthenticated"}`},
+		{"forbidden", apperr.Forbidden("not your sticker"), nil,
+			http.StatusForbidden, `{"error":"not your sticker","code":"forbidden"}`},
+		{"wrapped domain error", fmt.Errorf("lookup: %w", apperr.NotFound("sticker not found")), nil,
+			http.StatusNotFound, `{"error":"sticker not found","code":"not_found"}`},
+		{"internal with meta", errors.New("pq: relation does not exist"), "failed to insert user",
+			http.StatusInternalServerError, `{"error":"failed to insert user","code":"internal"}`},
+		{"internal without meta", errors.New("boom"), nil,
+			http.StatusInternalServerError, `{"error":"internal server error","code":"internal"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(handler.ErrorHandler())
+			r.GET("/fail", func(c *gin.Context) {
+				c.Error(tt.err).SetMeta(tt.meta)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/fail", nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestErrorHandler_LeavesWrittenResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(handler.ErrorHandler())
+	r.GET("/partial", func(c *gin.Context) {
+		c.JSON(http.StatusAccepted, gin.H{"ok": true})
+		c.Error(errors.New("late failure"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/partial", nil))
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"ok":true}`, w.Body.String())
+}
+
+func TestErrorHandler_LogsServerErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	r := gin.New()
+	r.Use(handler.ErrorHandler())
+	r.GET("/fail", func(c *gin.Context) {
+		c.Error(errors.New("pq: relation does not exist")).SetMeta("failed to insert user")
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.Error(apperr.NotFound("user not found"))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	assert.Empty(t, buf.String())
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	assert.Contains(t, buf.String(), `level=ERROR msg="failed to insert user" error="pq: relation does not exist"`)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/events"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+const lastEventIDHeader = "Last-Event-ID"
+
+// @Summary Stream a user's sticker events
+// @Description Server-Sent Events stream of star_awarded and level_up events for the user's stickers,
+// @Description whoever recorded the purchase. Each event's data is a models.StickerEvent.
+// @Description Idle streams get a comment line as a heartbeat. A client that reconnects with the
+// @Description Last-Event-ID header first receives the recent events it missed. A client that falls
+// @Description too far behind is disconnected and should reconnect the same way.
+// @Tags Stickers
+// @Produce text/event-stream
+// @Param user_id path string true "User ID" format(uuid)
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {object} models.StickerEvent
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users/{user_id}/events [get]
+func (h *Handler) StreamEvents(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var after uint64
+	if v := c.GetHeader(lastEventIDHeader); v != "" {
+		var err error
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.Error(apperr.Validation("Last-Event-ID must be an event id"))
+			return
+		}
+	}
+
+	sub, backlog := h.events.Subscribe(events.User(uri.UserID), after)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, e := range backlog {
+		if err := writeEvent(c.Writer, e); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			err = writeEvent(c.Writer, e)
+		case <-heartbeat.C:
+			_, err = io.WriteString(c.Writer, ": heartbeat\n\n")
+		}
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, e events.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
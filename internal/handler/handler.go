@@ -1,75 +1,222 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/emailtoken"
+	"github.com/m-garey/fetchit-backend/internal/events"
+	"github.com/m-garey/fetchit-backend/internal/live"
+	"github.com/m-garey/fetchit-backend/internal/mailer"
 	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
 	"github.com/m-garey/fetchit-backend/internal/repository"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+
+	defaultMailFrom        = "no-reply@fetchit.local"
+	defaultVerificationTTL = 24 * time.Hour
+	defaultAccessTTL       = 15 * time.Minute
+	defaultRefreshTTL      = 30 * 24 * time.Hour
+	defaultHeartbeat       = 15 * time.Second
 )
 
 type Handler struct {
-	repository repository.API
+	repository  repository.API
+	mailer      mailer.Mailer
+	emailTokens *emailtoken.Signer
+	verifyURL   string
+	tokens      *auth.Tokens
+	events      *events.Bus
+	heartbeat   time.Duration
+	live        *live.Hub
+}
+
+type Option func(*Handler)
+
+// WithMailer sets where verification emails are sent. The default writes them
+// to stderr.
+func WithMailer(m mailer.Mailer) Option {
+	return func(h *Handler) {
+		h.mailer = m
+	}
+}
+
+// WithAuth sets the token issuer used by the auth endpoints. It must be the
+// one auth.Middleware checks tokens with.
+func WithAuth(tokens *auth.Tokens) Option {
+	return func(h *Handler) {
+		h.tokens = tokens
+	}
+}
+
+// WithEmailVerification sets the token signer and the link, without its token
+// query parameter, that verification emails point to.
+func WithEmailVerification(tokens *emailtoken.Signer, url string) Option {
+	return func(h *Handler) {
+		h.emailTokens = tokens
+		h.verifyURL = url
+	}
+}
+
+// WithEvents sets the bus that sticker events are streamed from, and how often
+// idle streams send a heartbeat. The outbox relay publishes to it once
+// purchases commit.
+func WithEvents(bus *events.Bus, heartbeat time.Duration) Option {
+	return func(h *Handler) {
+		h.events = bus
+		h.heartbeat = heartbeat
+	}
+}
+
+// WithLiveUpdates sets the hub that serves WebSocket clients. It should
+// subscribe to the bus given to WithEvents.
+func WithLiveUpdates(hub *live.Hub) Option {
+	return func(h *Handler) {
+		h.live = hub
+	}
 }
 
 type API interface {
+	Signup(c *gin.Context)
+	Login(c *gin.Context)
+	Refresh(c *gin.Context)
+	Logout(c *gin.Context)
 	CreateUser(c *gin.Context)
+	GetUser(c *gin.Context)
+	UpdateUser(c *gin.Context)
+	DeleteUser(c *gin.Context)
+	ListUsers(c *gin.Context)
+	UpdateEmail(c *gin.Context)
+	VerifyEmail(c *gin.Context)
 	CreateStore(c *gin.Context)
+	GetStore(c *gin.Context)
+	UpdateStore(c *gin.Context)
+	DeactivateStore(c *gin.Context)
+	ReactivateStore(c *gin.Context)
+	ListStores(c *gin.Context)
+	GetStoreStats(c *gin.Context)
+	CreateAPIKey(c *gin.Context)
+	ListAPIKeys(c *gin.Context)
+	RevokeAPIKey(c *gin.Context)
+	CreateWebhook(c *gin.Context)
+	ListWebhooks(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	ListWebhookDeliveries(c *gin.Context)
 	RecordPurchase(c *gin.Context)
 	GetSticker(c *gin.Context)
 	GetStickersByUser(c *gin.Context)
+	ListUserPurchases(c *gin.Context)
+	ListStorePurchases(c *gin.Context)
+	ReplayProgress(c *gin.Context)
+	ListLevels(c *gin.Context)
+	UpdateLevel(c *gin.Context)
+	ListRoles(c *gin.Context)
+	AssignRole(c *gin.Context)
+	RevokeRole(c *gin.Context)
+	StreamEvents(c *gin.Context)
+	LiveUpdates(c *gin.Context)
 }
 
-func New(repository repository.API) *Handler {
-	return &Handler{repository: repository}
+func New(repository repository.API, opts ...Option) *Handler {
+	validation.Register()
+	h := &Handler{
+		repository:  repository,
+		mailer:      mailer.NewLog(os.Stderr, defaultMailFrom),
+		emailTokens: emailtoken.New(emailtoken.GenerateSecret(), defaultVerificationTTL),
+		verifyURL:   "/api/verify-email",
+		events:      events.New(),
+		heartbeat:   defaultHeartbeat,
+	}
+	tokens, err := auth.NewTokens(map[string][]byte{"default": auth.GenerateKey()}, "default", defaultAccessTTL, defaultRefreshTTL)
+	if err != nil {
+		panic(err)
+	}
+	h.tokens = tokens
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.live == nil {
+		h.live = live.New(h.events)
+	}
+	return h
 }
 
 // @Summary Create a new user
-// @Description Create a user with a given username
+// @Description Create a user with a given username. When an email is given,
+// @Description a verification link is sent to it.
+// @Description Admins only.
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Param user body models.UserRequest true "User info"
 // @Success 200 {object} models.UserResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /api/users [post]
 func (h *Handler) CreateUser(c *gin.Context) {
 	var req models.UserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		c.Error(validation.Error(err))
 		return
 	}
 
-	resp, err := h.repository.InsertUser(req)
+	resp, err := h.repository.InsertUser(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert user"})
+		c.Error(err).SetMeta("failed to insert user")
 		return
 	}
 
+	// The link goes to the address stored on the new account, which is the
+	// only one VerifyEmail will accept.
+	if resp.Email != "" {
+		h.trySendVerification(c.Request.Context(), resp.ID, resp.Email)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
 // @Summary Create a new store
-// @Description Register a new store with name and location
+// @Description Register a new store with name and location.
+// @Description Admins only.
 // @Tags Stores
 // @Accept json
 // @Produce json
 // @Param store body models.StoreRequest true "Store info"
 // @Success 200 {object} models.StoreResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
 // @Router /api/stores [post]
 func (h *Handler) CreateStore(c *gin.Context) {
 	var req models.StoreRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		c.Error(validation.Error(err))
 		return
 	}
 
-	resp, err := h.repository.InsertStore(req)
+	resp, err := h.repository.InsertStore(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert store"})
+		c.Error(err).SetMeta("failed to insert store")
 		return
 	}
 
@@ -77,47 +224,161 @@ func (h *Handler) CreateStore(c *gin.Context) {
 }
 
 // @Summary Record a user purchase
-// @Description Record a purchase and potentially award or level up a sticker
+// @Description Record a purchase and potentially award or level up a sticker.
+// @Description user_id defaults to the authenticated user and may not name anyone else.
+// @Description Store terminals authenticate with an API key instead, must name the user,
+// @Description may only record purchases at their own store, and are recorded as source pos:<key_id>.
+// @Description Retries by the same user or API key that send the same Idempotency-Key replay the original response.
+// @Description Purchases at a deactivated store are rejected with 422.
+// @Description The user's event streams are sent star_awarded, and level_up when a level is completed.
 // @Tags Purchases
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Client-generated key that makes retries safe"
 // @Param purchase body models.PurchaseRequest true "Purchase info"
 // @Success 200 {object} models.PurchaseResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/purchase [post]
 func (h *Handler) RecordPurchase(c *gin.Context) {
 	var req models.PurchaseRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		c.Error(validation.Error(err))
+		return
+	}
+
+	if err := attributePurchase(c, &req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		resp, err := h.repository.UpsertStar(c.Request.Context(), req)
+		if err != nil {
+			c.Error(err).SetMeta("failed to update sticker progress")
+			return
+		}
+		logPurchase(c.Request.Context(), req, false)
+
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		c.Error(apperr.Validation("idempotency key is too long"))
 		return
 	}
 
-	resp, err := h.repository.UpsertStar(req)
+	hash, err := requestHash(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update sticker progress"})
+		c.Error(err).SetMeta("failed to update sticker progress")
 		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	resp, err := h.repository.UpsertStarOnce(c.Request.Context(), req, models.IdempotencyKey{
+		Scope:       idempotencyScope(c, req),
+		Key:         key,
+		RequestHash: hash,
+	})
+	if err != nil {
+		c.Error(err).SetMeta("failed to update sticker progress")
+		return
+	}
+
+	logPurchase(c.Request.Context(), req, resp.Replayed)
+
+	if resp.Replayed {
+		c.Header(idempotentReplayedHeader, "true")
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", resp.Body)
+}
+
+func logPurchase(ctx context.Context, req models.PurchaseRequest, replayed bool) {
+	slog.InfoContext(ctx, "purchase recorded",
+		"user_id", req.UserID, "store_id", req.StoreID, "source", req.Source, "replayed", replayed)
+}
+
+// attributePurchase fills in and checks who is recording a purchase. A store
+// API key records purchases of any user at its own store and is named in the
+// source; users only record their own purchases.
+func attributePurchase(c *gin.Context, req *models.PurchaseRequest) error {
+	if key, ok := auth.APIKey(c); ok {
+		if req.UserID == "" {
+			return apperr.Validation("user_id is required when recording with an api key")
+		}
+		if req.StoreID != key.StoreID {
+			return apperr.Forbidden("cannot record purchases for another store")
+		}
+		req.Source = models.PurchaseSourcePOS + key.ID
+		return nil
+	}
+
+	actor, err := actingUser(c)
+	if err != nil {
+		return err
+	}
+	if req.UserID == "" {
+		req.UserID = actor
+	} else if req.UserID != actor {
+		return apperr.Forbidden("cannot record purchases for another user")
+	}
+	if strings.HasPrefix(req.Source, models.PurchaseSourcePOS) {
+		return apperr.Validation("source " + models.PurchaseSourcePOS + " is reserved for store api keys")
+	}
+	return nil
+}
+
+// idempotencyScope names the caller an idempotency key belongs to: the store
+// API key that sent it, or else the user.
+func idempotencyScope(c *gin.Context, req models.PurchaseRequest) string {
+	if key, ok := auth.APIKey(c); ok {
+		return "api_key:" + key.ID
+	}
+	return "user:" + req.UserID
+}
+
+// requestHash fingerprints the bound request rather than the raw body, so a
+// retry with different whitespace or key order still matches.
+func requestHash(req models.PurchaseRequest) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 // @Summary Get a specific user-store sticker
-// @Description Retrieve a sticker for a given user and store
+// @Description Retrieve the sticker a user has collected at a store, with the store details
+// @Description and how many stars are left until the next level
 // @Tags Stickers
 // @Produce json
-// @Param user_id query string true "User ID"
-// @Param store_id query string true "Store ID"
+// @Param user_id path string true "User ID" format(uuid)
+// @Param store_id path string true "Store ID" format(uuid)
 // @Success 200 {object} models.UserStickerResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
-// @Router /api/stickers/:user_id/:store_id [get]
+// @Security BearerAuth
+// @Router /api/users/{user_id}/stickers/{store_id} [get]
 func (h *Handler) GetSticker(c *gin.Context) {
-	userID := c.Query("user_id")
-	storeID := c.Query("store_id")
+	var uri stickerURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
 
-	resp, err := h.repository.GetSticker(userID, storeID)
+	resp, err := h.repository.GetSticker(c.Request.Context(), uri.UserID, uri.StoreID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get sticker"})
+		c.Error(err).SetMeta("failed to get sticker")
 		return
 	}
 
@@ -125,21 +386,71 @@ func (h *Handler) GetSticker(c *gin.Context) {
 }
 
 // @Summary Get all stickers for a user
-// @Description Retrieve all stickers that belong to a specific user
+// @Description Page through the stickers that belong to a specific user.
+// @Description Sorting by level follows the level chain, not level names.
 // @Tags Stickers
 // @Produce json
-// @Param user_id query string true "User ID"
+// @Param user_id path string true "User ID" format(uuid)
+// @Param level query string false "Only stickers at this level"
+// @Param sticker_theme query string false "Only stickers of stores with this sticker theme"
+// @Param sort query string false "Sort by level, star_count or last_updated (default)" Enums(level, star_count, last_updated)
+// @Param order query string false "asc or desc (default)" Enums(asc, desc)
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "next_cursor from the previous page"
 // @Success 200 {object} models.StickerByUserResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
-// @Router /api/stickers/:user_id [get]
+// @Security BearerAuth
+// @Router /api/users/{user_id}/stickers [get]
 func (h *Handler) GetStickersByUser(c *gin.Context) {
-	userID := c.Query("user_id")
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	filter, err := stickerFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
 
-	resp, err := h.repository.GetStickersByUser(userID)
+	resp, err := h.repository.GetStickersByUser(c.Request.Context(), uri.UserID, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user stickers"})
+		c.Error(err).SetMeta("failed to get user stickers")
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+func stickerFilter(c *gin.Context) (models.StickerFilter, error) {
+	filter := models.StickerFilter{
+		Level:        c.Query("level"),
+		StickerTheme: c.Query("sticker_theme"),
+		Sort:         c.DefaultQuery("sort", models.StickerSortLastUpdated),
+		Descending:   true,
+	}
+
+	switch filter.Sort {
+	case models.StickerSortLevel, models.StickerSortStarCount, models.StickerSortLastUpdated:
+	default:
+		return models.StickerFilter{}, apperr.Validation("sort must be one of level, star_count, last_updated")
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		filter.Descending = false
+	case "desc":
+	default:
+		return models.StickerFilter{}, apperr.Validation("order must be asc or desc")
+	}
+
+	var err error
+	filter.Page, err = pagination.Parse(c.Query("limit"), c.Query("cursor"))
+	if err != nil {
+		return models.StickerFilter{}, err
+	}
+	return filter, nil
+}
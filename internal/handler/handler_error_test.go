@@ -2,16 +2,25 @@ package handler_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/emailtoken"
 	"github.com/m-garey/fetchit-backend/internal/handler"
 	"github.com/m-garey/fetchit-backend/internal/mocks"
 	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/repository"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateUser_Error(t *testing.T) {
@@ -19,6 +28,7 @@ func TestCreateUser_Error(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
 	r.POST("/api/users", h.CreateUser)
 
 	invalidJSON := []byte(`{"invalid"}`)
@@ -34,20 +44,44 @@ func TestCreateUser_DBFailure(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
 	r.POST("/api/users", h.CreateUser)
 
 	reqBody := models.UserRequest{Username: "tester"}
-	mockRepo.On("InsertUser", reqBody).Return(models.UserResponse{}, errors.New("DB fail"))
+	mockRepo.On("InsertUser", mock.Anything, reqBody).Return(models.UserResponse{}, errors.New("DB fail"))
 
 	w := performRequest(r, "POST", "/api/users", reqBody)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestCreateUser_DuplicateUsername(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	h := handler.New(mockRepo,
+		handler.WithMailer(mockMailer),
+		handler.WithEmailVerification(emailtoken.New([]byte("secret"), time.Hour), "https://app.example.com/verify"),
+	)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/users", h.CreateUser)
+
+	reqBody := models.UserRequest{Username: "tester", Email: "someone-else@example.com"}
+	mockRepo.On("InsertUser", mock.Anything, reqBody).
+		Return(models.UserResponse{}, apperr.Conflict("resource already exists"))
+
+	w := performRequest(r, "POST", "/api/users", reqBody)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error":"resource already exists","code":"conflict"}`, w.Body.String())
+	mockMailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
 func TestCreateStore_Error(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
 	r.POST("/api/stores", h.CreateStore)
 
 	invalidJSON := []byte(`{"wrong"}`)
@@ -63,10 +97,12 @@ func TestRecordPurchase_DBFailure(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.Use(authenticatedAs(testUserID))
 	r.POST("/api/purchase", h.RecordPurchase)
 
-	reqBody := models.PurchaseRequest{UserID: "u1", StoreID: "s1"}
-	mockRepo.On("UpsertStar", reqBody).Return(models.PurchaseResponse{}, errors.New("fail"))
+	reqBody := models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}
+	mockRepo.On("UpsertStar", mock.Anything, reqBody).Return(models.PurchaseResponse{}, errors.New("fail"))
 
 	w := performRequest(r, "POST", "/api/purchase", reqBody)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
@@ -77,11 +113,12 @@ func TestGetSticker_DBError(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
-	r.GET("/api/stickers/:user_id/:store_id", h.GetSticker)
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers/:store_id", h.GetSticker)
 
-	mockRepo.On("GetSticker", "u1", "s1").Return(models.UserStickerResponse{}, errors.New("fetch error"))
+	mockRepo.On("GetSticker", mock.Anything, testUserID, testStoreID).Return(models.UserStickerResponse{}, errors.New("fetch error"))
 
-	req := httptest.NewRequest("GET", "/api/stickers/u1/s1?user_id=u1&store_id=s1", nil)
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers/"+testStoreID, nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
@@ -92,12 +129,727 @@ func TestGetStickersByUser_DBError(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
-	r.GET("/api/stickers/:user_id", h.GetStickersByUser)
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers", h.GetStickersByUser)
 
-	mockRepo.On("GetStickersByUser", "u1").Return(models.StickerByUserResponse{}, errors.New("fetch fail"))
+	mockRepo.On("GetStickersByUser", mock.Anything, testUserID, mock.Anything).Return(models.StickerByUserResponse{}, errors.New("fetch fail"))
 
-	req := httptest.NewRequest("GET", "/api/stickers/u1?user_id=u1", nil)
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
+
+func TestRecordPurchase_IdempotencyKeyReused(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.Use(authenticatedAs(testUserID))
+	r.POST("/api/purchase", h.RecordPurchase)
+
+	reqBody := models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}
+	mockRepo.On("UpsertStarOnce", mock.Anything, reqBody, mock.Anything).
+		Return(models.IdempotentPurchaseResponse{}, repository.ErrIdempotencyKeyReused)
+
+	w := performRequestWithHeaders(r, "POST", "/api/purchase", reqBody, map[string]string{"Idempotency-Key": "retry-1"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestRecordPurchase_IdempotencyKeyTooLong(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.Use(authenticatedAs(testUserID))
+	r.POST("/api/purchase", h.RecordPurchase)
+
+	reqBody := models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}
+	w := performRequestWithHeaders(r, "POST", "/api/purchase", reqBody, map[string]string{"Idempotency-Key": strings.Repeat("k", 256)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertNotCalled(t, "UpsertStarOnce", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestListUserPurchases_InvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/purchases", h.ListUserPurchases)
+
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2025-13-01T00:00:00Z",
+		"from=2025-07-01T00:00:00Z&to=2025-06-01T00:00:00Z",
+		"limit=0",
+		"cursor=not-a-cursor",
+	} {
+		req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/purchases?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	mockRepo.AssertNotCalled(t, "ListPurchasesByUser", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestListStorePurchases_DBError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores/:store_id/purchases", h.ListStorePurchases)
+
+	mockRepo.On("ListPurchasesByStore", mock.Anything, testStoreID, mock.Anything).Return(models.PurchaseListResponse{}, errors.New("fetch fail"))
+
+	req := httptest.NewRequest("GET", "/api/stores/"+testStoreID+"/purchases", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestReplayProgress_DBFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/admin/replay", h.ReplayProgress)
+
+	reqBody := models.ReplayRequest{StoreID: testStoreID}
+	mockRepo.On("ReplayProgress", mock.Anything, reqBody).Return(models.ReplayReport{}, errors.New("fail"))
+
+	w := performRequest(r, "POST", "/api/admin/replay", reqBody)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetSticker_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers/:store_id", h.GetSticker)
+
+	mockRepo.On("GetSticker", mock.Anything, testUserID, testStoreID).Return(models.UserStickerResponse{}, apperr.NotFound("sticker not found"))
+
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers/"+testStoreID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"sticker not found","code":"not_found"}`, w.Body.String())
+}
+
+func TestGetStickersByUser_UnknownUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers", h.GetStickersByUser)
+
+	mockRepo.On("GetStickersByUser", mock.Anything, testUserID, mock.Anything).Return(models.StickerByUserResponse{}, apperr.NotFound("user not found"))
+
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"user not found","code":"not_found"}`, w.Body.String())
+}
+
+func TestStickerRoutes_InvalidIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers", h.GetStickersByUser)
+	r.GET("/api/users/:user_id/stickers/:store_id", h.GetSticker)
+	r.GET("/api/stores/:store_id/purchases", h.ListStorePurchases)
+
+	for _, path := range []string{
+		"/api/users/u1/stickers",
+		"/api/users/u1/stickers/" + testStoreID,
+		"/api/users/" + testUserID + "/stickers/s1",
+		"/api/stores/s1/purchases",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+	mockRepo.AssertNotCalled(t, "GetSticker", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "GetStickersByUser", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/users", h.CreateUser)
+	r.POST("/api/stores", h.CreateStore)
+	r.POST("/api/stores/:store_id/api-keys", h.CreateAPIKey)
+	r.Use(authenticatedAs(testUserID))
+	r.POST("/api/purchase", h.RecordPurchase)
+
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		wantDetails []apperr.FieldError
+	}{
+		{"blank username", "/api/users", `{"username": "   "}`,
+			[]apperr.FieldError{{Field: "username", Rule: "required", Message: "is required"}}},
+		{"long username", "/api/users", `{"username": "` + strings.Repeat("a", 51) + `"}`,
+			[]apperr.FieldError{{Field: "username", Rule: "max", Message: "must be at most 50 characters"}}},
+		{"missing store name", "/api/stores", `{"location": "123 Main"}`,
+			[]apperr.FieldError{{Field: "store_name", Rule: "required", Message: "is required"}}},
+		{"long location", "/api/stores", `{"store_name": "Store A", "location": "` + strings.Repeat("l", 256) + `"}`,
+			[]apperr.FieldError{{Field: "location", Rule: "max", Message: "must be at most 255 characters"}}},
+		{"non-uuid purchase ids", "/api/purchase", `{"user_id": "u1", "store_id": "s1"}`,
+			[]apperr.FieldError{
+				{Field: "user_id", Rule: "uuid", Message: "must be a UUID"},
+				{Field: "store_id", Rule: "uuid", Message: "must be a UUID"},
+			}},
+		{"wrong type", "/api/purchase", `{"user_id": 7}`,
+			[]apperr.FieldError{{Field: "user_id", Rule: "type", Message: "must be a string"}}},
+		{"unknown api key scope", "/api/stores/" + testStoreID + "/api-keys", `{"name": "Till 1", "scopes": ["stores:write"]}`,
+			[]apperr.FieldError{{Field: "scopes[0]", Rule: "oneof", Message: "must be one of: purchases:write purchases:read"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var resp models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "validation", resp.Code)
+			assert.Equal(t, tt.wantDetails, resp.Details)
+		})
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateUser_TrimsUsername(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/users", h.CreateUser)
+
+	mockRepo.On("InsertUser", mock.Anything, models.UserRequest{Username: "tester"}).Return(models.UserResponse{ID: "abc123"}, nil)
+
+	req := httptest.NewRequest("POST", "/api/users", strings.NewReader(`{"username": "  tester\n"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetUser_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id", h.GetUser)
+
+	mockRepo.On("GetUser", mock.Anything, testUserID).Return(models.User{}, apperr.NotFound("user not found"))
+
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"user not found","code":"not_found"}`, w.Body.String())
+}
+
+func TestUpdateUser_DuplicateUsername(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PATCH("/api/users/:user_id", h.UpdateUser)
+
+	username := "taken"
+	mockRepo.On("UpdateUser", mock.Anything, testUserID, models.UserUpdateRequest{Username: &username}).
+		Return(models.User{}, apperr.Conflict("resource already exists"))
+
+	w := performRequest(r, "PATCH", "/api/users/"+testUserID, map[string]string{"username": username})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestUpdateUser_InvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PATCH("/api/users/:user_id", h.UpdateUser)
+
+	tests := []struct {
+		name string
+		path string
+		body any
+	}{
+		{"no fields", "/api/users/" + testUserID, map[string]string{}},
+		{"blank username", "/api/users/" + testUserID, map[string]string{"username": "  "}},
+		{"long username", "/api/users/" + testUserID, map[string]string{"username": strings.Repeat("a", 51)}},
+		{"invalid id", "/api/users/u1", map[string]string{"username": "tester"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performRequest(r, "PATCH", tt.path, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeleteUser_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.DELETE("/api/users/:user_id", h.DeleteUser)
+
+	mockRepo.On("DeleteUser", mock.Anything, testUserID).Return(apperr.NotFound("user not found"))
+
+	req := httptest.NewRequest("DELETE", "/api/users/"+testUserID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestListUsers_InvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users", h.ListUsers)
+
+	for _, query := range []string{"limit=0", "limit=abc", "cursor=not-a-cursor"} {
+		req := httptest.NewRequest("GET", "/api/users?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	mockRepo.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything)
+}
+
+func TestRecordPurchase_InactiveStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.Use(authenticatedAs(testUserID))
+	r.POST("/api/purchase", h.RecordPurchase)
+
+	reqBody := models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}
+	mockRepo.On("UpsertStar", mock.Anything, reqBody).Return(models.PurchaseResponse{}, repository.ErrStoreInactive)
+
+	w := performRequest(r, "POST", "/api/purchase", reqBody)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"error":"store is inactive and does not accept purchases","code":"unprocessable"}`, w.Body.String())
+}
+
+func TestUpdateStore_InvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PATCH("/api/stores/:store_id", h.UpdateStore)
+
+	for name, body := range map[string]map[string]string{
+		"no fields":  {},
+		"blank name": {"store_name": " "},
+		"long theme": {"sticker_theme": strings.Repeat("t", 101)},
+	} {
+		w := performRequest(r, "PATCH", "/api/stores/"+testStoreID, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+	mockRepo.AssertNotCalled(t, "UpdateStore", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeactivateStore_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/stores/:store_id/deactivate", h.DeactivateStore)
+
+	mockRepo.On("SetStoreActive", mock.Anything, testStoreID, false).Return(models.Store{}, apperr.NotFound("store not found"))
+
+	w := performRequest(r, "POST", "/api/stores/"+testStoreID+"/deactivate", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestListStores_InvalidActive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores", h.ListStores)
+
+	req := httptest.NewRequest("GET", "/api/stores?active=maybe", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertNotCalled(t, "ListStores", mock.Anything, mock.Anything)
+}
+
+func TestVerifyEmail_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	tokens := emailtoken.New([]byte("secret"), time.Hour)
+	h := handler.New(mockRepo, handler.WithEmailVerification(tokens, "/api/verify-email"))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/verify-email", h.VerifyEmail)
+
+	stale, err := tokens.Issue(testUserID, "old@example.com")
+	require.NoError(t, err)
+	mockRepo.On("VerifyEmail", mock.Anything, testUserID, "old@example.com").Return(models.User{}, repository.ErrVerificationStale)
+
+	forged, err := emailtoken.New([]byte("other"), time.Hour).Issue(testUserID, "old@example.com")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"missing token", "", http.StatusBadRequest},
+		{"forged token", "?token=" + forged, http.StatusBadRequest},
+		{"stale email", "?token=" + stale, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/verify-email"+tt.query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateEmail_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	h := handler.New(mockRepo, handler.WithMailer(mockMailer))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PUT("/api/users/:user_id/email", h.UpdateEmail)
+
+	w := performRequest(r, "PUT", "/api/users/"+testUserID+"/email", map[string]string{"email": "not-an-email"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"rule":"email"`)
+
+	mockRepo.On("UpdateEmail", mock.Anything, testUserID, "taken@example.com").
+		Return(models.User{}, apperr.Conflict("resource already exists"))
+	w = performRequest(r, "PUT", "/api/users/"+testUserID+"/email", map[string]string{"email": "taken@example.com"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockRepo.On("UpdateEmail", mock.Anything, testUserID, "new@example.com").
+		Return(models.User{ID: testUserID, Email: "new@example.com"}, nil)
+	mockMailer.On("Send", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+	w = performRequest(r, "PUT", "/api/users/"+testUserID+"/email", map[string]string{"email": "new@example.com"})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"error":"failed to send verification email","code":"unavailable"}`, w.Body.String())
+}
+
+func TestLogin_InvalidCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/login", h.Login)
+
+	hash, err := auth.HashPassword("correct horse")
+	require.NoError(t, err)
+	mockRepo.On("GetCredentials", mock.Anything, "tester").Return(models.Credentials{UserID: testUserID, PasswordHash: hash}, nil)
+	mockRepo.On("GetCredentials", mock.Anything, "legacy").Return(models.Credentials{UserID: testUserID}, nil)
+	mockRepo.On("GetCredentials", mock.Anything, "nobody").Return(models.Credentials{}, apperr.NotFound("user not found"))
+
+	for _, login := range []models.LoginRequest{
+		{Username: "tester", Password: "wrong horse"},
+		{Username: "legacy", Password: ""},
+		{Username: "legacy", Password: "anything"},
+		{Username: "nobody", Password: "correct horse"},
+	} {
+		w := performRequest(r, "POST", "/api/auth/login", login)
+		if login.Password == "" {
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			continue
+		}
+		assert.Equal(t, http.StatusUnauthorized, w.Code, login.Username)
+		assert.JSONEq(t, `{"error":"invalid username or password","code":"unauthenticated"}`, w.Body.String())
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	}
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSignup_Invalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/signup", h.Signup)
+
+	w := performRequest(r, "POST", "/api/auth/signup", map[string]string{"username": "tester", "password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"password"`)
+
+	mockRepo.On("CreateAccount", mock.Anything, mock.Anything, mock.Anything).Return(models.User{}, apperr.Conflict("resource already exists"))
+	w = performRequest(r, "POST", "/api/auth/signup", map[string]string{"username": "taken", "password": "long enough"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestSignup_MailerFailureStillLogsIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	h := handler.New(mockRepo, handler.WithAuth(newTestTokens(t)), handler.WithMailer(mockMailer))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/signup", h.Signup)
+
+	req := models.SignupRequest{Username: "tester", Email: "tester@example.com", Password: "correct horse"}
+	mockRepo.On("CreateAccount", mock.Anything, req, mock.Anything).
+		Return(models.User{ID: testUserID, Username: "tester", Email: "tester@example.com"}, nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, testUserID, mock.AnythingOfType("string"), time.Hour).Return(nil)
+	mockMailer.On("Send", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+
+	w := performRequest(r, "POST", "/api/auth/signup", req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var got models.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, testUserID, got.UserID)
+	assert.NotEmpty(t, got.AccessToken)
+	mockRepo.AssertExpectations(t)
+	mockMailer.AssertExpectations(t)
+}
+
+func TestCreateUser_MailerFailureStillCreates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	h := handler.New(mockRepo, handler.WithMailer(mockMailer))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/users", h.CreateUser)
+
+	req := models.UserRequest{Username: "tester", Email: "tester@example.com"}
+	mockRepo.On("InsertUser", mock.Anything, req).Return(models.UserResponse{ID: testUserID, Email: "tester@example.com"}, nil)
+	mockMailer.On("Send", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+
+	w := performRequest(r, "POST", "/api/users", req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user_id":"`+testUserID+`","email":"tester@example.com"}`, w.Body.String())
+	mockMailer.AssertExpectations(t)
+}
+
+func TestRefresh_InvalidToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/refresh", h.Refresh)
+
+	mockRepo.On("RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("", repository.ErrInvalidRefreshToken)
+
+	w := performRequest(r, "POST", "/api/auth/refresh", models.RefreshRequest{RefreshToken: "revoked"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error":"invalid refresh token","code":"unauthenticated"}`, w.Body.String())
+}
+
+func TestRecordPurchase_ActingUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/anonymous/purchase", h.RecordPurchase)
+	r.POST("/api/purchase", authenticatedAs(testUserID), h.RecordPurchase)
+
+	const otherUserID = "0d6f3a52-7b1e-4c9a-a2f4-5e8b9c1d7a36"
+	w := performRequest(r, "POST", "/api/purchase", models.PurchaseRequest{UserID: otherUserID, StoreID: testStoreID})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(r, "POST", "/api/anonymous/purchase", models.PurchaseRequest{StoreID: testStoreID})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	mockRepo.AssertNotCalled(t, "UpsertStar", mock.Anything, mock.Anything)
+}
+
+func TestRecordPurchase_APIKeyRestrictions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/pos/purchase", withAPIKey(models.APIKey{ID: testKeyID, StoreID: testStoreID}), h.RecordPurchase)
+	r.POST("/api/purchase", authenticatedAs(testUserID), h.RecordPurchase)
+
+	const otherStoreID = "e2b4c6d8-1a3f-4b5c-8d7e-9f0a1b2c3d4e"
+	w := performRequest(r, "POST", "/api/pos/purchase", models.PurchaseRequest{UserID: testUserID, StoreID: otherStoreID})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(r, "POST", "/api/pos/purchase", models.PurchaseRequest{StoreID: testStoreID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(r, "POST", "/api/purchase", models.PurchaseRequest{StoreID: testStoreID, Source: "pos:" + testKeyID})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "users cannot pass purchases off as a terminal's")
+
+	mockRepo.AssertNotCalled(t, "UpsertStar", mock.Anything, mock.Anything)
+}
+
+func TestRevokeAPIKey_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.DELETE("/api/stores/:store_id/api-keys/:key_id", h.RevokeAPIKey)
+
+	mockRepo.On("RevokeAPIKey", mock.Anything, testStoreID, testKeyID).Return(apperr.NotFound("api key not found"))
+
+	w := performRequest(r, "DELETE", "/api/stores/"+testStoreID+"/api-keys/"+testKeyID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"api key not found","code":"not_found"}`, w.Body.String())
+
+	w = performRequest(r, "DELETE", "/api/stores/"+testStoreID+"/api-keys/not-a-uuid", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAssignRole_Invalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/admin/users/:user_id/roles", h.AssignRole)
+
+	path := "/api/admin/users/" + testUserID + "/roles"
+	for _, body := range []models.RoleRequest{
+		{Role: models.RoleCustomer},
+		{Role: models.RoleStoreOperator},
+		{Role: models.RoleAdmin, StoreID: testStoreID},
+		{Role: models.RoleStoreOperator, StoreID: "not-a-uuid"},
+	} {
+		w := performRequest(r, "POST", path, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%+v", body)
+	}
+
+	mockRepo.On("AssignRole", mock.Anything, testUserID, models.RoleRequest{Role: models.RoleAdmin}).
+		Return(models.RoleAssignment{}, apperr.Conflict("resource already exists"))
+	w := performRequest(r, "POST", path, models.RoleRequest{Role: models.RoleAdmin})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestUpdateLevel_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PATCH("/api/admin/levels/:level", h.UpdateLevel)
+
+	w := performRequest(r, "PATCH", "/api/admin/levels/bronze", models.LevelUpdateRequest{StarsRequired: 0})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockRepo.On("UpdateLevel", mock.Anything, "platinum", models.LevelUpdateRequest{StarsRequired: 5}).
+		Return(models.StickerLevelRequirement{}, repository.ErrTerminalLevel)
+	w = performRequest(r, "PATCH", "/api/admin/levels/platinum", models.LevelUpdateRequest{StarsRequired: 5})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestGetStickersByUser_InvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers", h.GetStickersByUser)
+
+	for _, query := range []string{"sort=name", "order=up", "limit=0", "cursor=not-a-cursor"} {
+		w := performRequest(r, "GET", "/api/users/"+testUserID+"/stickers?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	mockRepo.AssertNotCalled(t, "GetStickersByUser", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestStreamEvents_InvalidLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handler.New(new(mocks.MockRepository))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/events", h.StreamEvents)
+
+	w := performRequestWithHeaders(r, "GET", "/api/users/"+testUserID+"/events", nil,
+		map[string]string{"Last-Event-ID": "latest"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLiveUpdates_InvalidToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := handler.New(new(mocks.MockRepository))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/live", h.LiveUpdates)
+
+	w := performRequestWithHeaders(r, "GET", "/api/live", nil,
+		map[string]string{"Authorization": "Bearer forged"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestWebhooks_InvalidRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/stores/:store_id/webhooks", h.CreateWebhook)
+	r.GET("/api/stores/:store_id/webhooks/:webhook_id/deliveries", h.ListWebhookDeliveries)
+
+	for _, body := range []map[string]any{
+		{"url": "ftp://partner.example.com", "event_types": []string{"level_up"}},
+		{"url": "not a url", "event_types": []string{"level_up"}},
+		{"url": "http://partner.example.com", "event_types": []string{"level_up"}},
+		{"url": "https://169.254.169.254/latest/meta-data", "event_types": []string{"level_up"}},
+		{"url": "https://localhost:8080/hooks", "event_types": []string{"level_up"}},
+		{"url": "https://partner.example.com", "event_types": []string{}},
+		{"url": "https://partner.example.com", "event_types": []string{"purchase_refunded"}},
+	} {
+		w := performRequest(r, "POST", "/api/stores/"+testStoreID+"/webhooks", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%+v", body)
+	}
+
+	w := performRequest(r, "GET", "/api/stores/"+testStoreID+"/webhooks/"+testKeyID+"/deliveries?status=failed", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertNotCalled(t, "CreateWebhook", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "ListWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -2,17 +2,36 @@
 package handler_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/m-garey/fetchit-backend/internal/auth"
+	"github.com/m-garey/fetchit-backend/internal/emailtoken"
+	"github.com/m-garey/fetchit-backend/internal/events"
 	"github.com/m-garey/fetchit-backend/internal/handler"
+	"github.com/m-garey/fetchit-backend/internal/live"
+	"github.com/m-garey/fetchit-backend/internal/mailer"
 	"github.com/m-garey/fetchit-backend/internal/mocks"
 	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/outbox"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUserID  = "4f1c2b8e-6a8d-4c0e-9d1a-2f6b7e3c9a10"
+	testStoreID = "9b2d7e41-3c5f-4a8b-8e6d-1f0a2c4b6d83"
 )
 
 func performRequest(r http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
@@ -25,16 +44,24 @@ func performRequest(r http.Handler, method, path string, body interface{}) *http
 	return w
 }
 
+// authenticatedAs stands in for auth.Middleware on routes under test.
+func authenticatedAs(userID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth.SetUserID(c, userID)
+	}
+}
+
 func TestCreateUser(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
 	r.POST("/api/users", h.CreateUser)
 
 	req := models.UserRequest{Username: "tester"}
 	resp := models.UserResponse{ID: "abc123"}
-	mockRepo.On("InsertUser", req).Return(resp, nil)
+	mockRepo.On("InsertUser", mock.Anything, req).Return(resp, nil)
 
 	w := performRequest(r, "POST", "/api/users", req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -46,11 +73,12 @@ func TestCreateStore(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
 	r.POST("/api/stores", h.CreateStore)
 
 	req := models.StoreRequest{Name: "Store A", Location: "123 Main"}
 	resp := models.StoreResponse{ID: "store123"}
-	mockRepo.On("InsertStore", req).Return(resp, nil)
+	mockRepo.On("InsertStore", mock.Anything, req).Return(resp, nil)
 
 	w := performRequest(r, "POST", "/api/stores", req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -62,11 +90,13 @@ func TestRecordPurchase(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.Use(authenticatedAs(testUserID))
 	r.POST("/api/purchase", h.RecordPurchase)
 
-	req := models.PurchaseRequest{UserID: "user1", StoreID: "store1"}
+	req := models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}
 	resp := models.PurchaseResponse{LevelUp: true, Level: "silver", StarCount: 5}
-	mockRepo.On("UpsertStar", req).Return(resp, nil)
+	mockRepo.On("UpsertStar", mock.Anything, req).Return(resp, nil)
 
 	w := performRequest(r, "POST", "/api/purchase", req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -78,23 +108,42 @@ func TestGetSticker(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
-	r.GET("/api/stickers/:user_id/:store_id", h.GetSticker)
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers/:store_id", h.GetSticker)
 
-	userID := "user1"
-	storeID := "store1"
+	userID := testUserID
+	storeID := testStoreID
 	resp := models.UserStickerResponse{
-		StoreName: "Store A",
-		Location:  "123 Main",
-		StarCount: 3,
-		Level:     "bronze",
+		StickerID:        "5d0c8e7a-1f2b-4c3d-9e8f-7a6b5c4d3e2f",
+		StoreID:          storeID,
+		StoreName:        "Store A",
+		Location:         "123 Main",
+		StickerTheme:     "ocean",
+		StarCount:        3,
+		Level:            "bronze",
+		NextLevel:        "silver",
+		StarsToNextLevel: 2,
+		LastUpdated:      time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
 	}
-	mockRepo.On("GetSticker", userID, storeID).Return(resp, nil)
+	mockRepo.On("GetSticker", mock.Anything, userID, storeID).Return(resp, nil)
 
-	req := httptest.NewRequest("GET", "/api/stickers/user1/store1?user_id=user1&store_id=store1", nil)
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers/"+testStoreID, nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"sticker_id": "5d0c8e7a-1f2b-4c3d-9e8f-7a6b5c4d3e2f",
+		"store_id": "`+storeID+`",
+		"store_name": "Store A",
+		"location": "123 Main",
+		"sticker_theme": "ocean",
+		"star_count": 3,
+		"level": "bronze",
+		"next_level": "silver",
+		"stars_to_next_level": 2,
+		"last_updated": "2025-06-01T12:00:00Z"
+	}`, w.Body.String())
 	mockRepo.AssertExpectations(t)
 }
 
@@ -103,20 +152,935 @@ func TestGetStickersByUser(t *testing.T) {
 	mockRepo := new(mocks.MockRepository)
 	h := handler.New(mockRepo)
 	r := gin.Default()
-	r.GET("/api/stickers/:user_id", h.GetStickersByUser)
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers", h.GetStickersByUser)
 
-	userID := "user1"
+	userID := testUserID
 	resp := models.StickerByUserResponse{
 		Stickers: []models.UserStickerResponse{
 			{StoreName: "Store A", Location: "123 Main", StarCount: 5, Level: "silver"},
 		},
 	}
-	mockRepo.On("GetStickersByUser", userID).Return(resp, nil)
+	filter := models.StickerFilter{Sort: models.StickerSortLastUpdated, Descending: true, Page: pagination.Page{Limit: pagination.DefaultLimit}}
+	mockRepo.On("GetStickersByUser", mock.Anything, userID, filter).Return(resp, nil)
+
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetSticker_PropagatesRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers/:store_id", h.GetSticker)
+
+	type ctxKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "request"))
+	cancel()
+
+	fromRequest := mock.MatchedBy(func(c context.Context) bool {
+		return c.Value(ctxKey{}) == "request" && c.Err() == context.Canceled
+	})
+	mockRepo.On("GetSticker", fromRequest, testUserID, testStoreID).Return(models.UserStickerResponse{}, context.Canceled)
+
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID+"/stickers/"+testStoreID, nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRecordPurchase_IdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.Use(authenticatedAs(testUserID))
+	r.POST("/api/purchase", h.RecordPurchase)
+
+	req := models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}
+	stored := []byte(`{"level_up":false,"level":"bronze","star_count":3}`)
+	withKey := mock.MatchedBy(func(k models.IdempotencyKey) bool {
+		return k.Scope == "user:"+testUserID && k.Key == "retry-1" && len(k.RequestHash) == 64
+	})
+	mockRepo.On("UpsertStarOnce", mock.Anything, req, withKey).
+		Return(models.IdempotentPurchaseResponse{Body: stored}, nil).Once()
+	mockRepo.On("UpsertStarOnce", mock.Anything, req, withKey).
+		Return(models.IdempotentPurchaseResponse{Body: stored, Replayed: true}, nil).Once()
+
+	first := performRequestWithHeaders(r, "POST", "/api/purchase", req, map[string]string{"Idempotency-Key": "retry-1"})
+	second := performRequestWithHeaders(r, "POST", "/api/purchase", req, map[string]string{"Idempotency-Key": "retry-1"})
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, stored, first.Body.Bytes())
+	assert.Equal(t, first.Body.Bytes(), second.Body.Bytes())
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	mockRepo.AssertNotCalled(t, "UpsertStar", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func performRequestWithHeaders(r http.Handler, method, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestListUserPurchases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/purchases", h.ListUserPurchases)
+
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	cursor := pagination.Cursor{Value: "2025-06-15T10:00:00Z", ID: "p9"}
+	filter := models.PurchaseFilter{
+		From: &from,
+		To:   &to,
+		Page: pagination.Page{Limit: 2, After: &cursor},
+	}
+	resp := models.PurchaseListResponse{
+		Purchases: []models.Purchase{
+			{ID: "p8", UserID: testUserID, StoreID: testStoreID, PurchaseTime: from.Add(time.Hour), Source: "app"},
+		},
+	}
+	mockRepo.On("ListPurchasesByUser", mock.Anything, testUserID, filter).Return(resp, nil)
 
-	req := httptest.NewRequest("GET", "/api/stickers/user1?user_id=user1", nil)
+	url := "/api/users/" + testUserID + "/purchases?from=2025-06-01T00:00:00Z&to=2025-07-01T00:00:00Z&limit=2&cursor=" + pagination.Encode(cursor)
+	req := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+	var got models.PurchaseListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "p8", got.Purchases[0].ID)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListStorePurchases(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores/:store_id/purchases", h.ListStorePurchases)
+
+	filter := models.PurchaseFilter{Page: pagination.Page{Limit: pagination.DefaultLimit}}
+	resp := models.PurchaseListResponse{Purchases: []models.Purchase{}, NextCursor: "next"}
+	mockRepo.On("ListPurchasesByStore", mock.Anything, testStoreID, filter).Return(resp, nil)
+
+	req := httptest.NewRequest("GET", "/api/stores/"+testStoreID+"/purchases", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"next_cursor":"next"`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestReplayProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/admin/replay", h.ReplayProgress)
+
+	req := models.ReplayRequest{UserID: testUserID, DryRun: true}
+	resp := models.ReplayReport{
+		DryRun:  true,
+		Scanned: 2,
+		Changed: 1,
+		Diffs: []models.StickerDiff{{
+			UserID:  testUserID,
+			StoreID: testStoreID,
+			Before:  &models.StickerState{Level: "bronze", StarCount: 7},
+			After:   &models.StickerState{Level: "silver", StarCount: 2},
+		}},
+	}
+	mockRepo.On("ReplayProgress", mock.Anything, req).Return(resp, nil)
+
+	w := performRequest(r, "POST", "/api/admin/replay", req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var got models.ReplayReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, resp, got)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id", h.GetUser)
+
+	user := models.User{ID: testUserID, Username: "tester", CreatedAt: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+	mockRepo.On("GetUser", mock.Anything, testUserID).Return(user, nil)
+
+	req := httptest.NewRequest("GET", "/api/users/"+testUserID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got models.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, user, got)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PATCH("/api/users/:user_id", h.UpdateUser)
+
+	username := "renamed"
+	user := models.User{ID: testUserID, Username: username}
+	mockRepo.On("UpdateUser", mock.Anything, testUserID, models.UserUpdateRequest{Username: &username}).Return(user, nil)
+
+	w := performRequest(r, "PATCH", "/api/users/"+testUserID, map[string]string{"username": "  renamed "})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"renamed"`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDeleteUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.DELETE("/api/users/:user_id", h.DeleteUser)
+
+	mockRepo.On("DeleteUser", mock.Anything, testUserID).Return(nil)
+
+	req := httptest.NewRequest("DELETE", "/api/users/"+testUserID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users", h.ListUsers)
+
+	cursor := pagination.Cursor{Value: "alice", ID: testUserID}
+	filter := models.UserFilter{Search: "ali", Page: pagination.Page{Limit: 10, After: &cursor}}
+	resp := models.UserListResponse{Users: []models.User{{ID: "u2", Username: "alicia"}}, NextCursor: "next"}
+	mockRepo.On("ListUsers", mock.Anything, filter).Return(resp, nil)
+
+	req := httptest.NewRequest("GET", "/api/users?search=ali&limit=10&cursor="+pagination.Encode(cursor), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got models.UserListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, resp, got)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores/:store_id", h.GetStore)
+
+	store := models.Store{ID: testStoreID, Name: "Store A", Location: "123 Main", StickerTheme: "ocean", IsActive: false}
+	mockRepo.On("GetStore", mock.Anything, testStoreID).Return(store, nil)
+
+	req := httptest.NewRequest("GET", "/api/stores/"+testStoreID, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"store_id":"`+testStoreID+`","name":"Store A","location":"123 Main","sticker_theme":"ocean","is_active":false}`,
+		w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PATCH("/api/stores/:store_id", h.UpdateStore)
+
+	theme, location := "forest", ""
+	req := models.StoreUpdateRequest{Location: &location, StickerTheme: &theme}
+	store := models.Store{ID: testStoreID, Name: "Store A", StickerTheme: theme, IsActive: true}
+	mockRepo.On("UpdateStore", mock.Anything, testStoreID, req).Return(store, nil)
+
+	w := performRequest(r, "PATCH", "/api/stores/"+testStoreID, map[string]string{"sticker_theme": " forest ", "location": ""})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sticker_theme":"forest"`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDeactivateAndReactivateStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/stores/:store_id/deactivate", h.DeactivateStore)
+	r.POST("/api/stores/:store_id/reactivate", h.ReactivateStore)
+
+	mockRepo.On("SetStoreActive", mock.Anything, testStoreID, false).Return(models.Store{ID: testStoreID, IsActive: false}, nil)
+	mockRepo.On("SetStoreActive", mock.Anything, testStoreID, true).Return(models.Store{ID: testStoreID, IsActive: true}, nil)
+
+	w := performRequest(r, "POST", "/api/stores/"+testStoreID+"/deactivate", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"is_active":false`)
+
+	w = performRequest(r, "POST", "/api/stores/"+testStoreID+"/reactivate", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"is_active":true`)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListStores(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores", h.ListStores)
+
+	active := true
+	filter := models.StoreFilter{
+		Active:       &active,
+		StickerTheme: "ocean",
+		Search:       "main",
+		Page:         pagination.Page{Limit: pagination.DefaultLimit},
+	}
+	resp := models.StoreListResponse{Stores: []models.Store{{ID: testStoreID, Name: "Main St", StickerTheme: "ocean", IsActive: true}}}
+	mockRepo.On("ListStores", mock.Anything, filter).Return(resp, nil)
+
+	req := httptest.NewRequest("GET", "/api/stores?active=true&sticker_theme=ocean&search=main", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got models.StoreListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, resp, got)
+	mockRepo.AssertExpectations(t)
+}
+
+// verificationToken pulls the token out of the link in a verification email.
+func verificationToken(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+	i := strings.Index(msg.Body, "token=")
+	if i < 0 {
+		t.Fatalf("no verification link in %q", msg.Body)
+	}
+	token, _, _ := strings.Cut(msg.Body[i+len("token="):], "\n")
+	return token
+}
+
+func TestEmailVerificationFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	h := handler.New(mockRepo,
+		handler.WithMailer(mockMailer),
+		handler.WithEmailVerification(emailtoken.New([]byte("secret"), time.Hour), "https://app.example.com/verify?src=mail"),
+	)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/users", h.CreateUser)
+	r.GET("/api/verify-email", h.VerifyEmail)
+	r.POST("/api/verify-email", h.VerifyEmail)
+
+	req := models.UserRequest{Username: "tester", Email: "tester@example.com"}
+	mockRepo.On("InsertUser", mock.Anything, req).Return(models.UserResponse{ID: testUserID, Email: "tester@example.com"}, nil)
+
+	var sent mailer.Message
+	mockMailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mailer.Message) bool {
+		return msg.To == "tester@example.com"
+	})).Run(func(args mock.Arguments) {
+		sent = args.Get(1).(mailer.Message)
+	}).Return(nil)
+
+	w := performRequest(r, "POST", "/api/users", req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, sent.Body, "https://app.example.com/verify?src=mail&token=")
+	token := verificationToken(t, sent)
+
+	verified := models.User{ID: testUserID, Username: "tester", Email: "tester@example.com", EmailVerified: true}
+	mockRepo.On("VerifyEmail", mock.Anything, testUserID, "tester@example.com").Return(verified, nil)
+
+	getReq := httptest.NewRequest("GET", "/api/verify-email?token="+token, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, getReq)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"email_verified":true`)
+
+	w = performRequest(r, "POST", "/api/verify-email", models.VerifyEmailRequest{Token: token})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mockRepo.AssertExpectations(t)
+	mockMailer.AssertExpectations(t)
+}
+
+func TestUpdateEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	mockMailer := new(mocks.MockMailer)
+	h := handler.New(mockRepo, handler.WithMailer(mockMailer))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.PUT("/api/users/:user_id/email", h.UpdateEmail)
+
+	user := models.User{ID: testUserID, Username: "tester", Email: "new@example.com"}
+	mockRepo.On("UpdateEmail", mock.Anything, testUserID, "new@example.com").Return(user, nil)
+	mockMailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mailer.Message) bool {
+		return msg.To == "new@example.com" && strings.Contains(msg.Body, "token=")
+	})).Return(nil)
+
+	w := performRequest(r, "PUT", "/api/users/"+testUserID+"/email", models.EmailRequest{Email: " new@example.com "})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"email_verified":false`)
+	mockRepo.AssertExpectations(t)
+	mockMailer.AssertExpectations(t)
+}
+
+func newTestTokens(t *testing.T) *auth.Tokens {
+	t.Helper()
+	tokens, err := auth.NewTokens(map[string][]byte{"test": []byte("secret")}, "test", 15*time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestSignup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	tokens := newTestTokens(t)
+	h := handler.New(mockRepo, handler.WithAuth(tokens))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/signup", h.Signup)
+
+	req := models.SignupRequest{Username: "tester", Password: "correct horse"}
+	mockRepo.On("CreateAccount", mock.Anything, req, mock.MatchedBy(func(hash string) bool {
+		return auth.CheckPassword(hash, "correct horse")
+	})).Return(models.User{ID: testUserID, Username: "tester"}, nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, testUserID, mock.AnythingOfType("string"), time.Hour).Return(nil)
+
+	w := performRequest(r, "POST", "/api/auth/signup", req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var got models.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, testUserID, got.UserID)
+	assert.Equal(t, "Bearer", got.TokenType)
+	assert.Equal(t, 900, got.ExpiresIn)
+	assert.NotEmpty(t, got.RefreshToken)
+
+	claims, err := tokens.ParseAccess(got.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, testUserID, claims.Subject)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	tokens := newTestTokens(t)
+	h := handler.New(mockRepo, handler.WithAuth(tokens))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/login", h.Login)
+
+	hash, err := auth.HashPassword("correct horse")
+	assert.NoError(t, err)
+	mockRepo.On("GetCredentials", mock.Anything, "tester").Return(models.Credentials{UserID: testUserID, PasswordHash: hash}, nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, testUserID, mock.AnythingOfType("string"), time.Hour).Return(nil)
+
+	w := performRequest(r, "POST", "/api/auth/login", models.LoginRequest{Username: "tester", Password: "correct horse"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var got models.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	_, err = tokens.ParseAccess(got.AccessToken)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo, handler.WithAuth(newTestTokens(t)))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/refresh", h.Refresh)
+
+	var newHash string
+	mockRepo.On("RotateRefreshToken", mock.Anything, auth.HashRefreshToken("old-token"), mock.AnythingOfType("string"), time.Hour).
+		Run(func(args mock.Arguments) { newHash = args.String(2) }).
+		Return(testUserID, nil)
+
+	w := performRequest(r, "POST", "/api/auth/refresh", models.RefreshRequest{RefreshToken: "old-token"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var got models.TokenResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, newHash, auth.HashRefreshToken(got.RefreshToken), "only the hash of the new token is stored")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/auth/logout", h.Logout)
+
+	mockRepo.On("RevokeRefreshToken", mock.Anything, auth.HashRefreshToken("some-token")).Return(nil)
+
+	w := performRequest(r, "POST", "/api/auth/logout", models.RefreshRequest{RefreshToken: "some-token"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRecordPurchase_DefaultsToActingUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	tokens := newTestTokens(t)
+	h := handler.New(mockRepo, handler.WithAuth(tokens))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/purchase", auth.Middleware(tokens), h.RecordPurchase)
+
+	mockRepo.On("UpsertStar", mock.Anything, models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID}).
+		Return(models.PurchaseResponse{Level: "bronze", StarCount: 1}, nil)
+
+	access, err := tokens.IssueAccess(testUserID)
+	assert.NoError(t, err)
+	w := performRequestWithHeaders(r, "POST", "/api/purchase", map[string]string{"store_id": testStoreID},
+		map[string]string{"Authorization": "Bearer " + access})
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+const testKeyID = "c3a8e5f1-2b7d-4e6a-9f0c-8d1b3a5e7c29"
+
+// withAPIKey stands in for auth.MiddlewareWithAPIKeys on routes under test.
+func withAPIKey(key models.APIKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth.SetAPIKey(c, key)
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/stores/:store_id/api-keys", h.CreateAPIKey)
+
+	req := models.APIKeyRequest{Name: "Till 1"}
+	var storedHash string
+	mockRepo.On("CreateAPIKey", mock.Anything, testStoreID, req, mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) { storedHash = args.String(3) }).
+		Return(models.APIKey{ID: testKeyID, StoreID: testStoreID, Name: "Till 1", Scopes: []string{models.ScopePurchasesWrite}}, nil)
+
+	w := performRequest(r, "POST", "/api/stores/"+testStoreID+"/api-keys", map[string]string{"name": "  Till 1 "})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var got models.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, testKeyID, got.ID)
+	assert.Equal(t, storedHash, auth.HashAPIKey(got.Key), "only the hash of the key is stored")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListAndRevokeAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores/:store_id/api-keys", h.ListAPIKeys)
+	r.DELETE("/api/stores/:store_id/api-keys/:key_id", h.RevokeAPIKey)
+
+	mockRepo.On("ListAPIKeys", mock.Anything, testStoreID).
+		Return(models.APIKeyListResponse{APIKeys: []models.APIKey{{ID: testKeyID, StoreID: testStoreID, Name: "Till 1"}}}, nil)
+	mockRepo.On("RevokeAPIKey", mock.Anything, testStoreID, testKeyID).Return(nil)
+
+	w := performRequest(r, "GET", "/api/stores/"+testStoreID+"/api-keys", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), testKeyID)
+	assert.NotContains(t, w.Body.String(), `"key"`)
+
+	w = performRequest(r, "DELETE", "/api/stores/"+testStoreID+"/api-keys/"+testKeyID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRecordPurchase_APIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/purchase", withAPIKey(models.APIKey{ID: testKeyID, StoreID: testStoreID}), h.RecordPurchase)
+
+	mockRepo.On("UpsertStar", mock.Anything, models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID, Source: "pos:" + testKeyID}).
+		Return(models.PurchaseResponse{Level: "bronze", StarCount: 1}, nil)
+
+	w := performRequest(r, "POST", "/api/purchase", models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID, Source: "app"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Keys sent by a terminal belong to its API key, not to the user.
+	mockRepo.On("UpsertStarOnce", mock.Anything, models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID, Source: "pos:" + testKeyID},
+		mock.MatchedBy(func(k models.IdempotencyKey) bool { return k.Scope == "api_key:"+testKeyID && k.Key == "retry-1" })).
+		Return(models.IdempotentPurchaseResponse{Body: []byte(`{}`)}, nil)
+	w = performRequestWithHeaders(r, "POST", "/api/purchase", models.PurchaseRequest{UserID: testUserID, StoreID: testStoreID},
+		map[string]string{"Idempotency-Key": "retry-1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRoleManagement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/admin/users/:user_id/roles", h.ListRoles)
+	r.POST("/api/admin/users/:user_id/roles", h.AssignRole)
+	r.DELETE("/api/admin/users/:user_id/roles/:role_id", h.RevokeRole)
+
+	const roleID = "5e7c9a1b-3d5f-4b8e-a0c2-4e6a8c0b2d4f"
+	req := models.RoleRequest{Role: models.RoleStoreOperator, StoreID: testStoreID}
+	assigned := models.RoleAssignment{ID: roleID, UserID: testUserID, Role: models.RoleStoreOperator, StoreID: testStoreID}
+	mockRepo.On("AssignRole", mock.Anything, testUserID, req).Return(assigned, nil)
+	mockRepo.On("ListRoles", mock.Anything, testUserID).Return(models.Roles{assigned}, nil)
+	mockRepo.On("RevokeRole", mock.Anything, testUserID, roleID).Return(nil)
+
+	w := performRequest(r, "POST", "/api/admin/users/"+testUserID+"/roles", req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = performRequest(r, "GET", "/api/admin/users/"+testUserID+"/roles", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got models.RoleListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, []models.RoleAssignment{assigned}, got.Roles)
+
+	w = performRequest(r, "DELETE", "/api/admin/users/"+testUserID+"/roles/"+roleID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLevels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/levels", h.ListLevels)
+	r.PATCH("/api/admin/levels/:level", h.UpdateLevel)
+
+	mockRepo.On("ListLevels", mock.Anything).Return(models.LevelListResponse{Levels: []models.StickerLevelRequirement{
+		{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+		{Level: "silver"},
+	}}, nil)
+	mockRepo.On("UpdateLevel", mock.Anything, "bronze", models.LevelUpdateRequest{StarsRequired: 3}).
+		Return(models.StickerLevelRequirement{Level: "bronze", StarsRequired: 3, NextLevel: "silver"}, nil)
+
+	w := performRequest(r, "GET", "/api/levels", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"level":"silver"`)
+
+	w = performRequest(r, "PATCH", "/api/admin/levels/bronze", models.LevelUpdateRequest{StarsRequired: 3})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"bronze","stars_required":3,"next_level":"silver"}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetStoreStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/stores/:store_id/stats", h.GetStoreStats)
+
+	mockRepo.On("GetStoreStats", mock.Anything, testStoreID).Return(models.StoreStats{
+		StoreID: testStoreID, Purchases: 12, PurchasesLast30Days: 4, Customers: 3,
+		StickersByLevel: map[string]int{"bronze": 2, "silver": 1},
+	}, nil)
+
+	w := performRequest(r, "GET", "/api/stores/"+testStoreID+"/stats", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"store_id":"`+testStoreID+`","purchases":12,"purchases_last_30_days":4,"customers":3,
+		"stickers_by_level":{"bronze":2,"silver":1}}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetStickersByUser_Query(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/stickers", h.GetStickersByUser)
+
+	cursor := pagination.Cursor{Value: "2", ID: "a1b2c3d4-0000-4000-8000-000000000000"}
+	filter := models.StickerFilter{
+		Level:        "silver",
+		StickerTheme: "ocean",
+		Sort:         models.StickerSortLevel,
+		Page:         pagination.Page{Limit: 10, After: &cursor},
+	}
+	mockRepo.On("GetStickersByUser", mock.Anything, testUserID, filter).
+		Return(models.StickerByUserResponse{Stickers: []models.UserStickerResponse{}, NextCursor: "next", Total: 12}, nil)
+
+	w := performRequest(r, "GET", "/api/users/"+testUserID+"/stickers?level=silver&sticker_theme=ocean&sort=level&order=asc&limit=10&cursor="+pagination.Encode(cursor), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"stickers":[],"next_cursor":"next","total":12}`, w.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+type sseEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// openEventStream subscribes to a user's events on srv and returns the events
+// it reads, skipping heartbeats.
+func openEventStream(t *testing.T, srv *httptest.Server, userID, lastEventID string) <-chan sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/users/"+userID+"/events", nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	ch := make(chan sseEvent)
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+		var e sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				e.ID = value
+			case "event":
+				e.Type = value
+			case "data":
+				e.Data = value
+			case "":
+				if e.Type != "" {
+					ch <- e
+				}
+				e = sseEvent{}
+			}
+		}
+	}()
+	return ch
+}
+
+func nextEvent(t *testing.T, ch <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		require.True(t, ok, "stream ended")
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+		return sseEvent{}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	bus := events.New()
+	h := handler.New(mockRepo, handler.WithEvents(bus, 10*time.Millisecond))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/users/:user_id/events", h.StreamEvents)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	stream := openEventStream(t, srv, testUserID, "")
+
+	// The outbox relay publishes a purchase's events once it commits; the
+	// customer's stream hears of them.
+	data := `{"user_id":"` + testUserID + `","store_id":"` + testStoreID + `","level":"silver","star_count":0}`
+	publish := outbox.Bus(bus)
+	for i, typ := range []string{models.EventStarAwarded, models.EventLevelUp} {
+		require.NoError(t, publish.Publish(context.Background(), models.OutboxMessage{
+			ID: int64(i + 1), EventType: typ, UserID: testUserID, StoreID: testStoreID, Payload: json.RawMessage(data),
+		}))
+	}
+
+	star := nextEvent(t, stream)
+	assert.Equal(t, models.EventStarAwarded, star.Type)
+	assert.JSONEq(t, data, star.Data)
+	levelUp := nextEvent(t, stream)
+	assert.Equal(t, models.EventLevelUp, levelUp.Type)
+	assert.JSONEq(t, data, levelUp.Data)
+
+	// Reconnecting after the first event replays the one that was missed.
+	resumed := openEventStream(t, srv, testUserID, star.ID)
+	assert.Equal(t, levelUp, nextEvent(t, resumed))
+
+	// Closing the bus, as on shutdown, ends open streams.
+	bus.Close()
+	for range stream {
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLiveUpdates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	tokens := newTestTokens(t)
+	bus := events.New()
+	h := handler.New(mockRepo, handler.WithAuth(tokens), handler.WithEvents(bus, time.Second))
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.GET("/api/live", h.LiveUpdates)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	const operatorID = "0d6f3a52-7b1e-4c9a-a2f4-5e8b9c1d7a36"
+	mockRepo.On("ListRoles", mock.Anything, operatorID).
+		Return(models.Roles{{Role: models.RoleStoreOperator, StoreID: testStoreID}}, nil)
+	access, err := tokens.IssueAccess(operatorID)
+	require.NoError(t, err)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/live", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	read := func() live.Message {
+		var m live.Message
+		require.NoError(t, ws.ReadJSON(&m))
+		return m
+	}
+
+	require.NoError(t, ws.WriteJSON(live.Request{Type: live.TypeAuth, Token: access}))
+	assert.Equal(t, live.TypeAuthenticated, read().Type)
+
+	// Operators follow their store, but not its customers.
+	require.NoError(t, ws.WriteJSON(live.Request{Type: live.TypeSubscribe, Topic: events.User(testUserID)}))
+	assert.Equal(t, live.TypeError, read().Type)
+	require.NoError(t, ws.WriteJSON(live.Request{Type: live.TypeSubscribe, Topic: events.Store(testStoreID)}))
+	assert.Equal(t, live.TypeSubscribed, read().Type)
+
+	require.NoError(t, outbox.Bus(bus).Publish(context.Background(), models.OutboxMessage{
+		ID: 1, EventType: models.EventStarAwarded, UserID: testUserID, StoreID: testStoreID,
+		Payload: json.RawMessage(`{"user_id":"` + testUserID + `","store_id":"` + testStoreID + `","level":"bronze","star_count":2}`),
+	}))
+
+	m := read()
+	assert.Equal(t, live.TypeEvent, m.Type)
+	assert.Equal(t, events.Store(testStoreID), m.Topic)
+	assert.Equal(t, models.EventStarAwarded, m.Event)
+	assert.Equal(t, map[string]any{
+		"user_id": testUserID, "store_id": testStoreID, "level": "bronze", "star_count": float64(2),
+	}, m.Data)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestWebhooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(mocks.MockRepository)
+	h := handler.New(mockRepo)
+	r := gin.Default()
+	r.Use(handler.ErrorHandler())
+	r.POST("/api/stores/:store_id/webhooks", h.CreateWebhook)
+	r.GET("/api/stores/:store_id/webhooks", h.ListWebhooks)
+	r.DELETE("/api/stores/:store_id/webhooks/:webhook_id", h.DeleteWebhook)
+	r.GET("/api/stores/:store_id/webhooks/:webhook_id/deliveries", h.ListWebhookDeliveries)
+
+	const webhookID = "2c9e4a7b-6d1f-4e3a-8b5c-0f7d9e1a3c5b"
+	req := models.WebhookRequest{URL: "https://partner.example.com/hooks", EventTypes: []string{models.EventLevelUp}}
+	hook := models.Webhook{ID: webhookID, StoreID: testStoreID, URL: req.URL, EventTypes: req.EventTypes}
+	var storedSecret string
+	mockRepo.On("CreateWebhook", mock.Anything, testStoreID, req, mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) { storedSecret = args.String(3) }).
+		Return(hook, nil)
+
+	w := performRequest(r, "POST", "/api/stores/"+testStoreID+"/webhooks", req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created models.WebhookResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, webhookID, created.ID)
+	assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+	assert.Equal(t, storedSecret, created.Secret)
+
+	mockRepo.On("ListWebhooks", mock.Anything, testStoreID).
+		Return(models.WebhookListResponse{Webhooks: []models.Webhook{hook}}, nil)
+	w = performRequest(r, "GET", "/api/stores/"+testStoreID+"/webhooks", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), webhookID)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	mockRepo.On("ListWebhookDeliveries", mock.Anything, testStoreID, webhookID,
+		models.WebhookDeliveryFilter{Status: models.DeliveryDead, Page: pagination.Page{Limit: 10}}).
+		Return(models.WebhookDeliveryListResponse{Deliveries: []models.WebhookDelivery{{
+			ID: "8f14e45f-ceea-4e7a-9c3b-2a1d0e9f8b7c", WebhookID: webhookID, EventType: models.EventLevelUp,
+			Payload: json.RawMessage(`{"level":"silver"}`), Status: models.DeliveryDead, Attempts: 8,
+		}}}, nil)
+	w = performRequest(r, "GET", "/api/stores/"+testStoreID+"/webhooks/"+webhookID+"/deliveries?status=dead&limit=10", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"payload":{"level":"silver"}`)
+
+	mockRepo.On("DeleteWebhook", mock.Anything, testStoreID, webhookID).Return(nil)
+	w = performRequest(r, "DELETE", "/api/stores/"+testStoreID+"/webhooks/"+webhookID, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
 	mockRepo.AssertExpectations(t)
 }
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary List sticker levels
+// @Description List the sticker levels in order, with the stars it takes to reach the next one
+// @Tags Stickers
+// @Produce json
+// @Success 200 {object} models.LevelListResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/levels [get]
+func (h *Handler) ListLevels(c *gin.Context) {
+	resp, err := h.repository.ListLevels(c.Request.Context())
+	if err != nil {
+		c.Error(err).SetMeta("failed to list sticker levels")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Change a sticker level requirement
+// @Description Change how many stars it takes to leave a level. Existing stickers are
+// @Description not recomputed; run a replay to apply the new requirement to them.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param level path string true "Level"
+// @Param requirement body models.LevelUpdateRequest true "New requirement"
+// @Success 200 {object} models.StickerLevelRequirement
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/admin/levels/{level} [patch]
+func (h *Handler) UpdateLevel(c *gin.Context) {
+	var uri levelURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.LevelUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.UpdateLevel(c.Request.Context(), uri.Level, req)
+	if err != nil {
+		c.Error(err).SetMeta("failed to update sticker level")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
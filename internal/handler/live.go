@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/events"
+	"github.com/m-garey/fetchit-backend/internal/live"
+)
+
+// @Summary Live sticker updates over WebSocket
+// @Description Upgrade to a WebSocket that pushes the sticker events of followed users and stores.
+// @Description Browsers cannot set headers on a WebSocket, so unless the upgrade request carries a
+// @Description bearer token the first message must be {"type":"auth","token":"<access token>"}.
+// @Description Then send {"type":"subscribe","topic":"user:<user_id>"} or "store:<store_id>", optionally
+// @Description with "last_event_id" to replay missed events, and {"type":"unsubscribe","topic":...} to stop.
+// @Description Users may follow themselves, store operators their stores and admins anything.
+// @Description Events arrive as {"type":"event","topic":...,"id":...,"event":"star_awarded","data":{...}}
+// @Description with a models.StickerEvent as data. The server pings every heartbeat interval; clients
+// @Description that stop answering, or fall too far behind, are disconnected.
+// @Tags Stickers
+// @Success 101
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Router /api/live [get]
+func (h *Handler) LiveUpdates(c *gin.Context) {
+	var authorize live.Authorizer
+	if scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " "); strings.EqualFold(scheme, "Bearer") {
+		var err error
+		if authorize, err = h.authorizeLive(c.Request.Context(), strings.TrimSpace(token)); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if err := h.live.Serve(c.Writer, c.Request, authorize, h.authorizeLive); err != nil {
+		c.Error(err)
+	}
+}
+
+// authorizeLive checks an access token and returns the topics its user may
+// follow, using the same rules as the REST routes: their own events, the
+// stores they operate, or anything for admins.
+func (h *Handler) authorizeLive(ctx context.Context, token string) (live.Authorizer, error) {
+	claims, err := h.tokens.ParseAccess(token)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := h.repository.ListRoles(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(topic events.Topic) error {
+		if roles.IsAdmin() {
+			return nil
+		}
+		switch kind, id := topic.Split(); kind {
+		case "user":
+			if id == claims.Subject {
+				return nil
+			}
+			return apperr.Forbidden("cannot follow another user's events")
+		case "store":
+			if roles.Operates(id) {
+				return nil
+			}
+			return apperr.Forbidden("cannot follow the events of a store you do not operate")
+		}
+		return apperr.Forbidden("cannot follow " + string(topic))
+	}, nil
+}
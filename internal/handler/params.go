@@ -0,0 +1,36 @@
+package handler
+
+// Path parameters shared by the resource routes. Binding them through
+// ShouldBindUri rejects malformed IDs before they reach the repository.
+
+type userURI struct {
+	UserID string `uri:"user_id" binding:"required,uuid"`
+}
+
+type storeURI struct {
+	StoreID string `uri:"store_id" binding:"required,uuid"`
+}
+
+type stickerURI struct {
+	UserID  string `uri:"user_id" binding:"required,uuid"`
+	StoreID string `uri:"store_id" binding:"required,uuid"`
+}
+
+type apiKeyURI struct {
+	StoreID string `uri:"store_id" binding:"required,uuid"`
+	KeyID   string `uri:"key_id" binding:"required,uuid"`
+}
+
+type roleURI struct {
+	UserID string `uri:"user_id" binding:"required,uuid"`
+	RoleID string `uri:"role_id" binding:"required,uuid"`
+}
+
+type levelURI struct {
+	Level string `uri:"level" binding:"required,max=20"`
+}
+
+type webhookURI struct {
+	StoreID   string `uri:"store_id" binding:"required,uuid"`
+	WebhookID string `uri:"webhook_id" binding:"required,uuid"`
+}
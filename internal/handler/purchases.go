@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary List a user's purchases
+// @Description Page through the purchase ledger of a user, newest first
+// @Tags Purchases
+// @Produce json
+// @Param user_id path string true "User ID" format(uuid)
+// @Param from query string false "Only purchases at or after this RFC 3339 time"
+// @Param to query string false "Only purchases before this RFC 3339 time"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.PurchaseListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users/{user_id}/purchases [get]
+func (h *Handler) ListUserPurchases(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	filter, err := purchaseFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := h.repository.ListPurchasesByUser(c.Request.Context(), uri.UserID, filter)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list purchases")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary List a store's purchases
+// @Description Page through the purchase ledger of a store, newest first.
+// @Description Users must operate the store or be admins. Store API keys need the purchases:read
+// @Description scope and only see their own store.
+// @Tags Purchases
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param from query string false "Only purchases at or after this RFC 3339 time"
+// @Param to query string false "Only purchases before this RFC 3339 time"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.PurchaseListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/stores/{store_id}/purchases [get]
+func (h *Handler) ListStorePurchases(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	filter, err := purchaseFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := h.repository.ListPurchasesByStore(c.Request.Context(), uri.StoreID, filter)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list purchases")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func purchaseFilter(c *gin.Context) (models.PurchaseFilter, error) {
+	var filter models.PurchaseFilter
+
+	from, err := queryTime(c, "from")
+	if err != nil {
+		return models.PurchaseFilter{}, err
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		return models.PurchaseFilter{}, err
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return models.PurchaseFilter{}, apperr.Validation("from must be before to")
+	}
+	filter.From, filter.To = from, to
+
+	filter.Page, err = pagination.Parse(c.Query("limit"), c.Query("cursor"))
+	if err != nil {
+		return models.PurchaseFilter{}, err
+	}
+
+	return filter, nil
+}
+
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, apperr.Validation(name + " must be an RFC 3339 timestamp")
+	}
+	t = t.UTC()
+	return &t, nil
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary List a user's roles
+// @Description List the roles granted to a user. Every user is also a customer.
+// @Tags Admin
+// @Produce json
+// @Param user_id path string true "User ID" format(uuid)
+// @Success 200 {object} models.RoleListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/admin/users/{user_id}/roles [get]
+func (h *Handler) ListRoles(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	roles, err := h.repository.ListRoles(c.Request.Context(), uri.UserID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list roles")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RoleListResponse{Roles: roles})
+}
+
+// @Summary Grant a user a role
+// @Description Make a user an admin, or a store operator of the store in store_id
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID" format(uuid)
+// @Param role body models.RoleRequest true "Role to grant"
+// @Success 201 {object} models.RoleAssignment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/admin/users/{user_id}/roles [post]
+func (h *Handler) AssignRole(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+	if req.Role == models.RoleStoreOperator && req.StoreID == "" {
+		c.Error(apperr.Validation("store_id is required for store operators"))
+		return
+	}
+	if req.Role != models.RoleStoreOperator && req.StoreID != "" {
+		c.Error(apperr.Validation("store_id is only allowed for store operators"))
+		return
+	}
+
+	resp, err := h.repository.AssignRole(c.Request.Context(), uri.UserID, req)
+	if err != nil {
+		c.Error(err).SetMeta("failed to assign role")
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary Revoke a role
+// @Description Take a granted role away from a user
+// @Tags Admin
+// @Param user_id path string true "User ID" format(uuid)
+// @Param role_id path string true "Role assignment ID" format(uuid)
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/admin/users/{user_id}/roles/{role_id} [delete]
+func (h *Handler) RevokeRole(c *gin.Context) {
+	var uri roleURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	if err := h.repository.RevokeRole(c.Request.Context(), uri.UserID, uri.RoleID); err != nil {
+		c.Error(err).SetMeta("failed to revoke role")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary Get a store
+// @Description Retrieve a store by ID, including inactive stores
+// @Tags Stores
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Success 200 {object} models.Store
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id} [get]
+func (h *Handler) GetStore(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.GetStore(c.Request.Context(), uri.StoreID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to get store")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Update a store
+// @Description Change the name, location or sticker theme of a store.
+// @Description Fields missing from the body are left unchanged; an empty location or sticker theme clears it.
+// @Description Only the store's operators and admins may change it.
+// @Tags Stores
+// @Accept json
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param store body models.StoreUpdateRequest true "Fields to change"
+// @Success 200 {object} models.Store
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id} [patch]
+func (h *Handler) UpdateStore(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.StoreUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+	if req.Name == nil && req.Location == nil && req.StickerTheme == nil {
+		c.Error(apperr.Validation("no fields to update"))
+		return
+	}
+
+	resp, err := h.repository.UpdateStore(c.Request.Context(), uri.StoreID, req)
+	if err != nil {
+		c.Error(err).SetMeta("failed to update store")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Deactivate a store
+// @Description Stop a store from accepting purchases. Its stickers and purchases stay readable.
+// @Description Admins only.
+// @Tags Stores
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Success 200 {object} models.Store
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/deactivate [post]
+func (h *Handler) DeactivateStore(c *gin.Context) {
+	h.setStoreActive(c, false)
+}
+
+// @Summary Reactivate a store
+// @Description Let a deactivated store accept purchases again.
+// @Description Admins only.
+// @Tags Stores
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Success 200 {object} models.Store
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/reactivate [post]
+func (h *Handler) ReactivateStore(c *gin.Context) {
+	h.setStoreActive(c, true)
+}
+
+func (h *Handler) setStoreActive(c *gin.Context, active bool) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.SetStoreActive(c.Request.Context(), uri.StoreID, active)
+	if err != nil {
+		c.Error(err).SetMeta("failed to update store")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary List stores
+// @Description Page through stores ordered by name
+// @Tags Stores
+// @Produce json
+// @Param active query bool false "Only active (true) or inactive (false) stores"
+// @Param sticker_theme query string false "Only stores with this sticker theme"
+// @Param search query string false "Only store names containing this text"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.StoreListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores [get]
+func (h *Handler) ListStores(c *gin.Context) {
+	filter := models.StoreFilter{
+		StickerTheme: c.Query("sticker_theme"),
+		Search:       c.Query("search"),
+	}
+
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			c.Error(apperr.Validation("active must be true or false"))
+			return
+		}
+		filter.Active = &active
+	}
+
+	var err error
+	filter.Page, err = pagination.Parse(c.Query("limit"), c.Query("cursor"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := h.repository.ListStores(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list stores")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Get store stats
+// @Description Summarize a store's purchases and the stickers its customers hold.
+// @Description Only the store's operators and admins may see them.
+// @Tags Stores
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Success 200 {object} models.StoreStats
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/stats [get]
+func (h *Handler) GetStoreStats(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.GetStoreStats(c.Request.Context(), uri.StoreID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to get store stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+)
+
+// @Summary Get a user
+// @Description Retrieve a user by ID
+// @Tags Users
+// @Produce json
+// @Param user_id path string true "User ID" format(uuid)
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users/{user_id} [get]
+func (h *Handler) GetUser(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.GetUser(c.Request.Context(), uri.UserID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Update a user
+// @Description Change the fields of a user that are present in the body
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID" format(uuid)
+// @Param user body models.UserUpdateRequest true "Fields to change"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users/{user_id} [patch]
+func (h *Handler) UpdateUser(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.UserUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+	if req.Username == nil {
+		c.Error(apperr.Validation("no fields to update"))
+		return
+	}
+
+	resp, err := h.repository.UpdateUser(c.Request.Context(), uri.UserID, req)
+	if err != nil {
+		c.Error(err).SetMeta("failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Delete a user
+// @Description Delete a user together with their stickers and purchases
+// @Tags Users
+// @Param user_id path string true "User ID" format(uuid)
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users/{user_id} [delete]
+func (h *Handler) DeleteUser(c *gin.Context) {
+	var uri userURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	if err := h.repository.DeleteUser(c.Request.Context(), uri.UserID); err != nil {
+		c.Error(err).SetMeta("failed to delete user")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List users
+// @Description Page through users ordered by username.
+// @Description Admins only.
+// @Tags Users
+// @Produce json
+// @Param search query string false "Only usernames containing this text"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.UserListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/users [get]
+func (h *Handler) ListUsers(c *gin.Context) {
+	page, err := pagination.Parse(c.Query("limit"), c.Query("cursor"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filter := models.UserFilter{Search: c.Query("search"), Page: page}
+	resp, err := h.repository.ListUsers(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list users")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+	"github.com/m-garey/fetchit-backend/internal/webhook"
+)
+
+// @Summary Register a webhook
+// @Description Have the store's star_awarded and/or level_up events POSTed to an https URL on a public host.
+// @Description Redirects are not followed.
+// @Description Each delivery is signed in the X-Fetchit-Signature header as t=<unix time>,v1=<hex HMAC-SHA256
+// @Description of "<unix time>.<body>"> keyed with the secret, which is only returned by this call.
+// @Description Failed deliveries are retried with exponential backoff and dead-lettered after the last attempt.
+// @Description Only the store's operators and admins may manage its webhooks.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param webhook body models.WebhookRequest true "URL and event types"
+// @Success 201 {object} models.WebhookResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/webhooks [post]
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+	if err := webhook.CheckURL(req.URL); err != nil {
+		c.Error(apperr.InvalidFields("invalid request", []apperr.FieldError{{
+			Field:   "url",
+			Rule:    "webhook_url",
+			Message: "must be an https URL on a public host",
+		}}, err))
+		return
+	}
+
+	secret := webhook.NewSecret()
+	hook, err := h.repository.CreateWebhook(c.Request.Context(), uri.StoreID, req, secret)
+	if err != nil {
+		c.Error(err).SetMeta("failed to create webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.WebhookResponse{Webhook: hook, Secret: secret})
+}
+
+// @Summary List a store's webhooks
+// @Description List every webhook registered for a store, oldest first
+// @Tags Webhooks
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Success 200 {object} models.WebhookListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/webhooks [get]
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	var uri storeURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	resp, err := h.repository.ListWebhooks(c.Request.Context(), uri.StoreID)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list webhooks")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Delete a webhook
+// @Description Stop sending events to a webhook and drop its delivery log, pending deliveries included.
+// @Tags Webhooks
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param webhook_id path string true "Webhook ID" format(uuid)
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/webhooks/{webhook_id} [delete]
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	var uri webhookURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	if err := h.repository.DeleteWebhook(c.Request.Context(), uri.StoreID, uri.WebhookID); err != nil {
+		c.Error(err).SetMeta("failed to delete webhook")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List a webhook's deliveries
+// @Description Page through the deliveries of a webhook, newest first, with the outcome of the last attempt.
+// @Description Dead deliveries ran out of attempts and are not retried.
+// @Tags Webhooks
+// @Produce json
+// @Param store_id path string true "Store ID" format(uuid)
+// @Param webhook_id path string true "Webhook ID" format(uuid)
+// @Param status query string false "Only deliveries in this state" Enums(pending, delivered, dead)
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.WebhookDeliveryListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Security BearerAuth
+// @Router /api/stores/{store_id}/webhooks/{webhook_id}/deliveries [get]
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	var uri webhookURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.Error(validation.Error(err))
+		return
+	}
+
+	filter := models.WebhookDeliveryFilter{Status: c.Query("status")}
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		c.Error(apperr.Validation("status must be pending, delivered or dead"))
+		return
+	}
+
+	var err error
+	filter.Page, err = pagination.Parse(c.Query("limit"), c.Query("cursor"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := h.repository.ListWebhookDeliveries(c.Request.Context(), uri.StoreID, uri.WebhookID, filter)
+	if err != nil {
+		c.Error(err).SetMeta("failed to list webhook deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
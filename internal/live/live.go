@@ -0,0 +1,396 @@
+// Package live pushes sticker events to WebSocket clients. A client
+// authenticates, then subscribes to the user and store topics it may follow.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/events"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultSendBuffer   = 64
+
+	writeWait        = 10 * time.Second
+	authWait         = 10 * time.Second
+	maxMessageSize   = 4096
+	maxSubscriptions = 32
+)
+
+// Message types. Clients send auth, subscribe and unsubscribe; the server
+// answers with the rest.
+const (
+	TypeAuth          = "auth"
+	TypeSubscribe     = "subscribe"
+	TypeUnsubscribe   = "unsubscribe"
+	TypeAuthenticated = "authenticated"
+	TypeSubscribed    = "subscribed"
+	TypeUnsubscribed  = "unsubscribed"
+	TypeEvent         = "event"
+	TypeError         = "error"
+)
+
+var ErrClosed = apperr.Unavailable("live updates are shutting down")
+
+// Request is a message from the client. LastEventID on a subscribe first
+// replays the retained events the client missed.
+type Request struct {
+	Type        string       `json:"type"`
+	Token       string       `json:"token,omitempty"`
+	Topic       events.Topic `json:"topic,omitempty"`
+	LastEventID uint64       `json:"last_event_id,omitempty"`
+}
+
+// Message is a message from the server. Event messages carry the event's ID,
+// type and data.
+type Message struct {
+	Type  string       `json:"type"`
+	Topic events.Topic `json:"topic,omitempty"`
+	ID    uint64       `json:"id,omitempty"`
+	Event string       `json:"event,omitempty"`
+	Data  any          `json:"data,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// Authorizer decides whether an authenticated client may follow a topic.
+type Authorizer func(events.Topic) error
+
+// Authenticator checks the token a client authenticates with.
+type Authenticator func(ctx context.Context, token string) (Authorizer, error)
+
+// Hub serves the WebSocket connections and ends them all on Shutdown, which
+// http.Server.Shutdown cannot do for hijacked connections.
+type Hub struct {
+	bus          *events.Bus
+	upgrader     websocket.Upgrader
+	pingInterval time.Duration
+	sendBuffer   int
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type Option func(*Hub)
+
+// WithKeepalive sets how often connections are pinged. A connection that
+// answers nothing for two intervals is closed.
+func WithKeepalive(interval time.Duration) Option {
+	return func(h *Hub) {
+		h.pingInterval = interval
+	}
+}
+
+// WithSendBuffer sets how many messages may wait for a slow client before the
+// events feeding it start to back up.
+func WithSendBuffer(n int) Option {
+	return func(h *Hub) {
+		h.sendBuffer = n
+	}
+}
+
+func New(bus *events.Bus, opts ...Option) *Hub {
+	h := &Hub{
+		bus: bus,
+		upgrader: websocket.Upgrader{
+			// Clients authenticate with a token rather than cookies, so a
+			// page on another origin gains nothing by opening a socket.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		pingInterval: defaultPingInterval,
+		sendBuffer:   defaultSendBuffer,
+		conns:        make(map[*conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Serve upgrades the request and handles the connection until it closes. A
+// client that was not authorized from its request must send an auth message
+// first. Errors are only returned before the upgrade, while the caller can
+// still answer with them.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, authorize Authorizer, authenticate Authenticator) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return ErrClosed
+	}
+	h.wg.Add(1)
+	h.mu.Unlock()
+	defer h.wg.Done()
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		return nil
+	}
+
+	c := &conn{
+		hub:       h,
+		ws:        ws,
+		send:      make(chan Message, h.sendBuffer),
+		done:      make(chan struct{}),
+		subs:      make(map[events.Topic]*events.Subscription),
+		authorize: authorize,
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		return nil
+	}
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.writeLoop()
+	c.readLoop(r.Context(), authenticate)
+
+	c.close(websocket.CloseNormalClosure, "")
+	c.unsubscribeAll()
+	c.wg.Wait()
+
+	h.mu.Lock()
+	delete(h.conns, c)
+	h.mu.Unlock()
+	return nil
+}
+
+// Shutdown closes every connection, refuses new ones and waits for their
+// handlers to return.
+func (h *Hub) Shutdown() {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	h.wg.Wait()
+}
+
+type conn struct {
+	hub       *Hub
+	ws        *websocket.Conn
+	send      chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+	// authorize is only used by the read loop.
+	authorize Authorizer
+
+	mu   sync.Mutex
+	subs map[events.Topic]*events.Subscription
+}
+
+func (c *conn) readLoop(ctx context.Context, authenticate Authenticator) {
+	pongWait := 2 * c.hub.pingInterval
+	c.ws.SetReadLimit(maxMessageSize)
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	if c.authorize == nil {
+		c.ws.SetReadDeadline(time.Now().Add(authWait))
+	} else {
+		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+		c.push(Message{Type: TypeAuthenticated})
+	}
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.push(Message{Type: TypeError, Error: "invalid message"})
+			continue
+		}
+		if !c.handle(ctx, req, authenticate) {
+			return
+		}
+	}
+}
+
+// handle answers one request and reports whether the connection stays open.
+func (c *conn) handle(ctx context.Context, req Request, authenticate Authenticator) bool {
+	if req.Type == TypeAuth {
+		if c.authorize != nil {
+			return c.push(Message{Type: TypeError, Error: "already authenticated"})
+		}
+		authorize, err := authenticate(ctx, req.Token)
+		if err != nil {
+			c.close(websocket.ClosePolicyViolation, errorText(err))
+			return false
+		}
+		c.authorize = authorize
+		return c.push(Message{Type: TypeAuthenticated})
+	}
+
+	if c.authorize == nil {
+		c.close(websocket.ClosePolicyViolation, "authenticate first")
+		return false
+	}
+
+	switch req.Type {
+	case TypeSubscribe:
+		return c.subscribe(req.Topic, req.LastEventID)
+	case TypeUnsubscribe:
+		c.mu.Lock()
+		sub, ok := c.subs[req.Topic]
+		delete(c.subs, req.Topic)
+		c.mu.Unlock()
+		if !ok {
+			return c.push(Message{Type: TypeError, Topic: req.Topic, Error: "not subscribed"})
+		}
+		sub.Close()
+		return c.push(Message{Type: TypeUnsubscribed, Topic: req.Topic})
+	default:
+		return c.push(Message{Type: TypeError, Error: "unknown message type"})
+	}
+}
+
+func (c *conn) subscribe(topic events.Topic, afterID uint64) bool {
+	kind, id := topic.Split()
+	if (kind != "user" && kind != "store") || id == "" {
+		return c.push(Message{Type: TypeError, Topic: topic, Error: "topic must be user:<user_id> or store:<store_id>"})
+	}
+	if err := c.authorize(topic); err != nil {
+		return c.push(Message{Type: TypeError, Topic: topic, Error: errorText(err)})
+	}
+
+	c.mu.Lock()
+	if _, ok := c.subs[topic]; ok {
+		c.mu.Unlock()
+		return c.push(Message{Type: TypeError, Topic: topic, Error: "already subscribed"})
+	}
+	if len(c.subs) >= maxSubscriptions {
+		c.mu.Unlock()
+		return c.push(Message{Type: TypeError, Topic: topic, Error: "too many subscriptions"})
+	}
+	sub, backlog := c.hub.bus.Subscribe(topic, afterID)
+	c.subs[topic] = sub
+	c.mu.Unlock()
+
+	if !c.push(Message{Type: TypeSubscribed, Topic: topic}) {
+		return false
+	}
+	for _, e := range backlog {
+		if !c.push(eventMessage(topic, e)) {
+			return false
+		}
+	}
+
+	c.wg.Add(1)
+	go c.forward(topic, sub)
+	return true
+}
+
+// forward relays a subscription's events. A client too slow to keep up
+// backs up the subscription until the bus drops it; the client is then
+// disconnected and can resubscribe with the last event ID it saw.
+func (c *conn) forward(topic events.Topic, sub *events.Subscription) {
+	defer c.wg.Done()
+	for e := range sub.Events() {
+		if !c.push(eventMessage(topic, e)) {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	dropped := c.subs[topic] == sub
+	c.mu.Unlock()
+	if dropped {
+		c.close(websocket.CloseTryAgainLater, "fell behind; resubscribe with last_event_id")
+	}
+}
+
+func (c *conn) unsubscribeAll() {
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = make(map[events.Topic]*events.Subscription)
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// push queues a message for the writer, waiting while the buffer is full. It
+// reports false once the connection is closed.
+func (c *conn) push(m Message) bool {
+	select {
+	case c.send <- m:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *conn) writeLoop() {
+	defer c.wg.Done()
+	ping := time.NewTicker(c.hub.pingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case m := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			err = c.ws.WriteJSON(m)
+		case <-ping.C:
+			err = c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		}
+		if err != nil {
+			c.close(websocket.CloseAbnormalClosure, "")
+			return
+		}
+	}
+}
+
+// close tells the client why the connection ends, when there is a reason to
+// send, and closes it. Only the first call has an effect.
+func (c *conn) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if code != websocket.CloseAbnormalClosure {
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+		}
+		c.ws.Close()
+	})
+}
+
+func eventMessage(topic events.Topic, e events.Event) Message {
+	return Message{Type: TypeEvent, Topic: topic, ID: e.ID, Event: e.Type, Data: e.Data}
+}
+
+// errorText keeps internal errors, such as a failed role lookup, away from
+// the client.
+func errorText(err error) string {
+	var e *apperr.Error
+	if errors.As(err, &e) && e.Kind != apperr.KindInternal {
+		return e.Message
+	}
+	return "internal error"
+}
@@ -0,0 +1,211 @@
+package live
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allowToken accepts the token "valid" for following user:alice only.
+func allowToken(_ context.Context, token string) (Authorizer, error) {
+	if token != "valid" {
+		return nil, apperr.Unauthenticated("invalid access token")
+	}
+	return func(topic events.Topic) error {
+		if topic != events.User("alice") {
+			return apperr.Forbidden("cannot follow " + string(topic))
+		}
+		return nil
+	}, nil
+}
+
+func newTestHub(t *testing.T, bus *events.Bus, opts ...Option) (*Hub, string) {
+	t.Helper()
+	hub := New(bus, opts...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := hub.Serve(w, r, nil, allowToken); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return hub, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func send(t *testing.T, ws *websocket.Conn, req Request) {
+	t.Helper()
+	require.NoError(t, ws.WriteJSON(req))
+}
+
+func read(t *testing.T, ws *websocket.Conn) Message {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var m Message
+	require.NoError(t, ws.ReadJSON(&m))
+	return m
+}
+
+func closeCode(t *testing.T, ws *websocket.Conn) int {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			return closeErr.Code
+		}
+	}
+}
+
+func TestHub_SubscribeAndReceive(t *testing.T) {
+	bus := events.New()
+	_, url := newTestHub(t, bus)
+	ws := dial(t, url)
+
+	send(t, ws, Request{Type: TypeAuth, Token: "valid"})
+	assert.Equal(t, TypeAuthenticated, read(t, ws).Type)
+
+	send(t, ws, Request{Type: TypeSubscribe, Topic: events.Store("corner-shop")})
+	m := read(t, ws)
+	assert.Equal(t, TypeError, m.Type)
+	assert.Equal(t, "cannot follow store:corner-shop", m.Error)
+
+	send(t, ws, Request{Type: TypeSubscribe, Topic: events.User("alice")})
+	assert.Equal(t, Message{Type: TypeSubscribed, Topic: events.User("alice")}, read(t, ws))
+
+	e := bus.Publish("star_awarded", "first", events.User("alice"))
+	m = read(t, ws)
+	assert.Equal(t, Message{Type: TypeEvent, Topic: events.User("alice"), ID: e.ID, Event: "star_awarded", Data: "first"}, m)
+
+	send(t, ws, Request{Type: TypeUnsubscribe, Topic: events.User("alice")})
+	assert.Equal(t, TypeUnsubscribed, read(t, ws).Type)
+}
+
+func TestHub_ResubscribeReplaysMissedEvents(t *testing.T) {
+	bus := events.New()
+	_, url := newTestHub(t, bus)
+	seen := bus.Publish("star_awarded", "seen", events.User("alice"))
+	missed := bus.Publish("level_up", "missed", events.User("alice"))
+
+	ws := dial(t, url)
+	send(t, ws, Request{Type: TypeAuth, Token: "valid"})
+	read(t, ws)
+	send(t, ws, Request{Type: TypeSubscribe, Topic: events.User("alice"), LastEventID: seen.ID})
+	assert.Equal(t, TypeSubscribed, read(t, ws).Type)
+
+	m := read(t, ws)
+	assert.Equal(t, missed.ID, m.ID)
+	assert.Equal(t, "missed", m.Data)
+}
+
+func TestHub_RequiresAuthentication(t *testing.T) {
+	_, url := newTestHub(t, events.New())
+
+	ws := dial(t, url)
+	send(t, ws, Request{Type: TypeSubscribe, Topic: events.User("alice")})
+	assert.Equal(t, websocket.ClosePolicyViolation, closeCode(t, ws))
+
+	ws = dial(t, url)
+	send(t, ws, Request{Type: TypeAuth, Token: "forged"})
+	assert.Equal(t, websocket.ClosePolicyViolation, closeCode(t, ws))
+}
+
+func TestHub_Keepalive(t *testing.T) {
+	_, url := newTestHub(t, events.New(), WithKeepalive(20*time.Millisecond))
+	ws := dial(t, url)
+
+	pinged := make(chan struct{}, 1)
+	ws.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	send(t, ws, Request{Type: TypeAuth, Token: "valid"})
+	read(t, ws)
+
+	// Reading lets the ping handler run; a client that never answers pongs
+	// is closed once the read deadline passes.
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := ws.ReadMessage()
+	require.Error(t, err)
+	select {
+	case <-pinged:
+	default:
+		t.Fatal("no ping received")
+	}
+}
+
+func TestHub_DisconnectsSlowClients(t *testing.T) {
+	bus := events.New(events.WithBuffer(1))
+	_, url := newTestHub(t, bus, WithSendBuffer(1))
+	ws := dial(t, url)
+	send(t, ws, Request{Type: TypeAuth, Token: "valid"})
+	read(t, ws)
+	send(t, ws, Request{Type: TypeSubscribe, Topic: events.User("alice")})
+	read(t, ws)
+
+	// Without reading, the socket, the send buffer and finally the
+	// subscription fill up.
+	payload := strings.Repeat("x", 1024)
+	deadline := time.Now().Add(5 * time.Second)
+	code := 0
+	for code == 0 && time.Now().Before(deadline) {
+		for range 1000 {
+			bus.Publish("star_awarded", payload, events.User("alice"))
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		ws.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		for {
+			_, _, err := ws.ReadMessage()
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				code = closeErr.Code
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	assert.Equal(t, websocket.CloseTryAgainLater, code)
+}
+
+func TestHub_Shutdown(t *testing.T) {
+	hub, url := newTestHub(t, events.New())
+	ws := dial(t, url)
+	send(t, ws, Request{Type: TypeAuth, Token: "valid"})
+	read(t, ws)
+
+	done := make(chan struct{})
+	go func() {
+		hub.Shutdown()
+		close(done)
+	}()
+	assert.Equal(t, websocket.CloseGoingAway, closeCode(t, ws))
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
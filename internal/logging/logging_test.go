@@ -0,0 +1,204 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// capture makes the default logger write JSON lines to the returned buffer
+// for the rest of the test.
+func capture(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(New(&buf, config.Logging{Level: level, Format: "json"}))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// lines decodes the JSON lines written to buf.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &m))
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestNew_RedactsPersonalData(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.Logging{Level: slog.LevelInfo, Format: "json"})
+	logger.Info("account created",
+		"user_id", "alice-id",
+		"username", "alice",
+		slog.Group("account", "Email", "alice@example.com", "password", "hunter2"))
+
+	got := lines(t, &buf)
+	require.Len(t, got, 1)
+	assert.Equal(t, "account created", got[0]["msg"])
+	assert.Equal(t, "alice-id", got[0]["user_id"])
+	assert.Equal(t, redacted, got[0]["username"])
+	assert.Equal(t, map[string]any{"Email": redacted, "password": redacted}, got[0]["account"])
+	assert.NotContains(t, buf.String(), "alice@example.com")
+}
+
+func TestNew_LevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.Logging{Level: slog.LevelWarn, Format: "text"})
+	logger.Info("hidden")
+	logger.Warn("shown", "username", "alice")
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "level=WARN msg=shown username=[REDACTED]")
+}
+
+func TestNew_AddsRequestAndTraceIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.Logging{Level: slog.LevelInfo, Format: "json"}).With("component", "test")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(WithRequestID(context.Background(), "req-1"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	logger.InfoContext(ctx, "hello")
+	logger.Info("no context")
+
+	got := lines(t, &buf)
+	require.Len(t, got, 2)
+	assert.Equal(t, "test", got[0]["component"])
+	assert.Equal(t, "req-1", got[0]["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", got[0]["trace_id"])
+	assert.NotContains(t, got[1], "request_id")
+	assert.NotContains(t, got[1], "trace_id")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := capture(t, slog.LevelInfo)
+
+	var seen string
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/users/:user_id", func(c *gin.Context) {
+		seen = RequestID(c.Request.Context())
+		c.String(http.StatusNotFound, "missing")
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"client id is kept", "abc-123_x.y:z", true},
+		{"missing id is made", "", false},
+		{"unsafe id is replaced", "bad id\n", false},
+		{"overlong id is replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/api/users/alice?token=secret", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.keep {
+				assert.Equal(t, tt.header, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+			assert.Equal(t, id, seen)
+
+			got := lines(t, buf)
+			require.Len(t, got, 1)
+			assert.Equal(t, "request", got[0]["msg"])
+			assert.Equal(t, "WARN", got[0]["level"])
+			assert.Equal(t, id, got[0]["request_id"])
+			assert.Equal(t, "GET", got[0]["method"])
+			assert.Equal(t, "/api/users/:user_id", got[0]["route"])
+			assert.Equal(t, "/api/users/alice", got[0]["path"])
+			assert.Equal(t, float64(http.StatusNotFound), got[0]["status"])
+			assert.Equal(t, float64(len("missing")), got[0]["bytes"])
+			assert.NotContains(t, buf.String(), "secret")
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := capture(t, slog.LevelInfo)
+
+	r := gin.New()
+	r.Use(Middleware(), Recovery())
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"internal server error","code":"internal"}`, w.Body.String())
+
+	got := lines(t, buf)
+	require.Len(t, got, 2)
+	assert.Equal(t, "panic serving request", got[0]["msg"])
+	assert.Equal(t, "boom", got[0]["panic"])
+	assert.Contains(t, got[0]["stack"], "runtime/debug.Stack")
+	assert.Equal(t, got[1]["request_id"], got[0]["request_id"])
+	assert.Equal(t, "ERROR", got[1]["level"])
+}
+
+func TestQueryLogger(t *testing.T) {
+	l := NewQueryLogger()
+	sql := "SELECT * FROM Users WHERE username = $1"
+
+	t.Run("skipped above debug", func(t *testing.T) {
+		buf := capture(t, slog.LevelInfo)
+		ctx := l.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql})
+		l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("logged at debug without arguments", func(t *testing.T) {
+		buf := capture(t, slog.LevelDebug)
+		ctx := l.TraceQueryStart(WithRequestID(context.Background(), "req-1"), nil,
+			pgx.TraceQueryStartData{SQL: sql, Args: []any{"alice"}})
+		l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{
+			CommandTag: pgconn.NewCommandTag("UPDATE 3"),
+			Err:        errors.New("deadlock detected"),
+		})
+
+		got := lines(t, buf)
+		require.Len(t, got, 1)
+		assert.Equal(t, "query", got[0]["msg"])
+		assert.Equal(t, "DEBUG", got[0]["level"])
+		assert.Equal(t, sql, got[0]["sql"])
+		assert.Equal(t, float64(3), got[0]["rows"])
+		assert.Equal(t, "deadlock detected", got[0]["error"])
+		assert.Equal(t, "req-1", got[0]["request_id"])
+		assert.NotContains(t, buf.String(), "alice")
+	})
+}
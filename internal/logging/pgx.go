@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QueryLogger is a pgx.QueryTracer that logs each query at debug level with
+// its duration and the rows it affected. Arguments are left out, since they
+// carry usernames, emails and password hashes.
+type QueryLogger struct{}
+
+func NewQueryLogger() *QueryLogger {
+	return &QueryLogger{}
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql string
+	at  time.Time
+}
+
+func (l *QueryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return ctx
+	}
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now()})
+}
+
+func (l *QueryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("sql", start.sql),
+		slog.Duration("duration", time.Since(start.at)),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	}
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		attrs = append(attrs, slog.String("error", data.Err.Error()))
+	}
+	slog.LogAttrs(ctx, slog.LevelDebug, "query", attrs...)
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	raw := string(format("no-reply@fetchit.local", Message{
+		To:      "tester@example.com",
+		Subject: "Confirm your email ✉",
+		Body:    "line one\nline two",
+	}, date))
+
+	assert.Contains(t, raw, "From: no-reply@fetchit.local\r\n")
+	assert.Contains(t, raw, "To: tester@example.com\r\n")
+	assert.Contains(t, raw, "Subject: =?utf-8?q?Confirm_your_email_=E2=9C=89?=\r\n")
+	assert.Contains(t, raw, "Date: Sun, 01 Jun 2025 12:00:00 +0000\r\n")
+	assert.True(t, strings.HasSuffix(raw, "\r\n\r\nline one\r\nline two\r\n"))
+}
+
+func TestLog_Send(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLog(&buf, "no-reply@fetchit.local")
+
+	require.NoError(t, m.Send(context.Background(), Message{To: "tester@example.com", Subject: "Hi", Body: "hello"}))
+	assert.Contains(t, buf.String(), "To: tester@example.com")
+	assert.Contains(t, buf.String(), "hello")
+}
+
+func TestSMTP_Send(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go serveSMTP(t, ln, received)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	m := NewSMTP(host, p, "", "", "no-reply@fetchit.local")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, m.Send(ctx, Message{To: "tester@example.com", Subject: "Hi", Body: "hello"}))
+
+	data := <-received
+	assert.Contains(t, data, "To: tester@example.com")
+	assert.Contains(t, data, "hello")
+}
+
+// serveSMTP accepts one connection and plays the server side of a minimal
+// SMTP exchange, sending the DATA payload to received.
+func serveSMTP(t *testing.T, ln net.Listener, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			received <- data.String()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			t.Errorf("unexpected SMTP command %q", cmd)
+			reply("500 unknown")
+		}
+	}
+}
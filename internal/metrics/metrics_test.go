@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/m-garey/fetchit-backend/internal/mocks"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware_LabelsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/api/users/:user_id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", gin.WrapH(m.Handler()))
+
+	for _, path := range []string{"/api/users/alice", "/api/users/bob", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/api/users/:user_id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "unmatched", "404")))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, _ := io.ReadAll(w.Body)
+	assert.Contains(t, string(body),
+		`fetchit_http_request_duration_seconds_count{method="GET",route="/api/users/:user_id",status="200"} 2`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestRepository_CountsPurchases(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	mockRepo := new(mocks.MockRepository)
+	repo := m.Repository(mockRepo)
+
+	app := models.PurchaseRequest{UserID: "alice", StoreID: "corner-shop"}
+	mockRepo.On("UpsertStar", ctx, app).
+		Return(models.PurchaseResponse{Level: "bronze", StarCount: 1, NewSticker: true}, nil).Once()
+	pos := models.PurchaseRequest{UserID: "alice", StoreID: "corner-shop", Source: models.PurchaseSourcePOS + "key-1"}
+	mockRepo.On("UpsertStar", ctx, pos).
+		Return(models.PurchaseResponse{LevelUp: true, Level: "silver"}, nil).Once()
+	mockRepo.On("UpsertStar", ctx, pos).Return(models.PurchaseResponse{}, errors.New("store is inactive")).Once()
+
+	_, err := repo.UpsertStar(ctx, app)
+	require.NoError(t, err)
+	_, err = repo.UpsertStar(ctx, pos)
+	require.NoError(t, err)
+	_, err = repo.UpsertStar(ctx, pos)
+	require.Error(t, err)
+
+	// A replayed idempotent purchase awarded nothing.
+	key := models.IdempotencyKey{Key: "k", RequestHash: "h"}
+	body := []byte(`{"level_up":true,"level":"gold","star_count":0,"new_sticker":false}`)
+	mockRepo.On("UpsertStarOnce", ctx, app, key).Return(models.IdempotentPurchaseResponse{Body: body}, nil).Once()
+	mockRepo.On("UpsertStarOnce", ctx, app, key).Return(models.IdempotentPurchaseResponse{Body: body, Replayed: true}, nil).Once()
+	_, err = repo.UpsertStarOnce(ctx, app, key)
+	require.NoError(t, err)
+	_, err = repo.UpsertStarOnce(ctx, app, key)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.purchases.WithLabelValues("app")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.purchases.WithLabelValues("pos")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.stars))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.levelUps.WithLabelValues("silver")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.levelUps.WithLabelValues("gold")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stickers))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRepository_PassesOtherCallsThrough(t *testing.T) {
+	mockRepo := new(mocks.MockRepository)
+	mockRepo.On("ListLevels", mock.Anything).Return(models.LevelListResponse{}, nil)
+
+	_, err := New().Repository(mockRepo).ListLevels(context.Background())
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPoolCollector(t *testing.T) {
+	// The pool only connects on first use, so no database is needed.
+	pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/fetchit?pool_max_conns=7")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	c := NewPoolCollector(pool)
+	assert.Equal(t, 12, testutil.CollectAndCount(c))
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP fetchit_db_pool_max_connections Most connections the pool will open.
+# TYPE fetchit_db_pool_max_connections gauge
+fetchit_db_pool_max_connections 7
+`), "fetchit_db_pool_max_connections"))
+}
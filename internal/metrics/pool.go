@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector reports the statistics of a pgx connection pool each time it
+// is scraped.
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired, idle, constructing, total, max  *prometheus.Desc
+	acquires, acquireSeconds, canceled, empty *prometheus.Desc
+	created, lifetimeDestroyed, idleDestroyed *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &PoolCollector{
+		pool:              pool,
+		acquired:          desc("acquired_connections", "Connections currently checked out of the pool."),
+		idle:              desc("idle_connections", "Idle connections in the pool."),
+		constructing:      desc("constructing_connections", "Connections being opened."),
+		total:             desc("connections", "Connections in the pool, in any state."),
+		max:               desc("max_connections", "Most connections the pool will open."),
+		acquires:          desc("acquires_total", "Connections acquired from the pool."),
+		acquireSeconds:    desc("acquire_seconds_total", "Time spent waiting to acquire connections."),
+		canceled:          desc("canceled_acquires_total", "Acquires given up because their context ended."),
+		empty:             desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		created:           desc("connections_created_total", "Connections opened."),
+		lifetimeDestroyed: desc("lifetime_destroyed_connections_total", "Connections closed for reaching their maximum lifetime."),
+		idleDestroyed:     desc("idle_destroyed_connections_total", "Connections closed for idling too long."),
+	}
+}
+
+func (p *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(p, ch)
+}
+
+func (p *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := p.pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+
+	gauge(p.acquired, float64(s.AcquiredConns()))
+	gauge(p.idle, float64(s.IdleConns()))
+	gauge(p.constructing, float64(s.ConstructingConns()))
+	gauge(p.total, float64(s.TotalConns()))
+	gauge(p.max, float64(s.MaxConns()))
+	counter(p.acquires, float64(s.AcquireCount()))
+	counter(p.acquireSeconds, s.AcquireDuration().Seconds())
+	counter(p.canceled, float64(s.CanceledAcquireCount()))
+	counter(p.empty, float64(s.EmptyAcquireCount()))
+	counter(p.created, float64(s.NewConnsCount()))
+	counter(p.lifetimeDestroyed, float64(s.MaxLifetimeDestroyCount()))
+	counter(p.idleDestroyed, float64(s.MaxIdleDestroyCount()))
+}
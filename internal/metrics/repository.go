@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/repository"
+)
+
+// instrumentedRepository counts what recorded purchases earn. Every other
+// method goes straight to the wrapped repository.
+type instrumentedRepository struct {
+	repository.API
+	metrics *Metrics
+}
+
+// Repository wraps api so the purchases recorded through it are counted.
+func (m *Metrics) Repository(api repository.API) repository.API {
+	return &instrumentedRepository{API: api, metrics: m}
+}
+
+func (r *instrumentedRepository) UpsertStar(ctx context.Context, req models.PurchaseRequest) (models.PurchaseResponse, error) {
+	resp, err := r.API.UpsertStar(ctx, req)
+	if err == nil {
+		r.metrics.purchaseRecorded(req, resp)
+	}
+	return resp, err
+}
+
+// UpsertStarOnce counts a purchase once: replays awarded nothing.
+func (r *instrumentedRepository) UpsertStarOnce(ctx context.Context, req models.PurchaseRequest, key models.IdempotencyKey) (models.IdempotentPurchaseResponse, error) {
+	resp, err := r.API.UpsertStarOnce(ctx, req, key)
+	if err == nil && !resp.Replayed {
+		var purchase models.PurchaseResponse
+		if json.Unmarshal(resp.Body, &purchase) == nil {
+			r.metrics.purchaseRecorded(req, purchase)
+		}
+	}
+	return resp, err
+}
+
+func (m *Metrics) purchaseRecorded(req models.PurchaseRequest, resp models.PurchaseResponse) {
+	// Terminals are named by key ID in the source; one series for all of them
+	// is enough.
+	source := models.PurchaseSourceApp
+	if strings.HasPrefix(req.Source, models.PurchaseSourcePOS) {
+		source = strings.TrimSuffix(models.PurchaseSourcePOS, ":")
+	}
+	m.purchases.WithLabelValues(source).Inc()
+	m.stars.Inc()
+	if resp.LevelUp {
+		m.levelUps.WithLabelValues(resp.Level).Inc()
+	}
+	if resp.NewSticker {
+		m.stickers.Inc()
+	}
+}
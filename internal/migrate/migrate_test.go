@@ -0,0 +1,233 @@
+package migrate_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX a ON t (b);")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX a;")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE t (b INT);")},
+		"0001_init.down.sql":      {Data: []byte("DROP TABLE t;")},
+	}
+
+	migrations, err := migrate.Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "init", migrations[0].Name)
+	assert.Equal(t, "CREATE TABLE t (b INT);", migrations[0].Up)
+	assert.Equal(t, "DROP TABLE t;", migrations[0].Down)
+	assert.Equal(t, int64(2), migrations[1].Version)
+	assert.NotEqual(t, migrations[0].Checksum, migrations[1].Checksum)
+}
+
+func TestLoad_ChecksumTracksUpFile(t *testing.T) {
+	original := fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("CREATE TABLE t (b INT);")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+	edited := fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("CREATE TABLE t (b BIGINT);")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+
+	a, err := migrate.Load(original)
+	require.NoError(t, err)
+	b, err := migrate.Load(edited)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a[0].Checksum, b[0].Checksum)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"bad file name", fstest.MapFS{
+			"init.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"missing down", fstest.MapFS{
+			"0001_init.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"missing up", fstest.MapFS{
+			"0001_init.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{"conflicting names", fstest.MapFS{
+			"0001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.Load(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := migrate.Load(os.DirFS("migrations"))
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "migration versions must be contiguous")
+	}
+}
+
+// connect opens a connection whose unqualified tables, schema_migrations
+// included, live in a schema of their own, so tests can migrate up and down
+// without touching the shared test database. Every connection of a test uses
+// the same schema. Tests are skipped when TEST_DATABASE_URL is unset.
+func connect(t *testing.T) func() *pgx.Conn {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+
+	admin, err := pgx.Connect(ctx, url)
+	require.NoError(t, err)
+	_, err = admin.Exec(ctx, `CREATE SCHEMA `+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		admin.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+		admin.Close(ctx)
+	})
+
+	return func() *pgx.Conn {
+		cfg, err := pgx.ParseConfig(url)
+		require.NoError(t, err)
+		cfg.RuntimeParams["search_path"] = schema
+		conn, err := pgx.ConnectConfig(ctx, cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(ctx) })
+		return conn
+	}
+}
+
+func tableExists(t *testing.T, conn *pgx.Conn, name string) bool {
+	t.Helper()
+	var exists bool
+	require.NoError(t, conn.QueryRow(context.Background(),
+		`SELECT EXISTS (SELECT 1 FROM pg_tables WHERE schemaname = current_schema() AND tablename = $1)`, name).
+		Scan(&exists))
+	return exists
+}
+
+func TestMigrator_UpDownRoundTrip(t *testing.T) {
+	conn := connect(t)()
+	ctx := context.Background()
+
+	m, err := migrate.New(conn)
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, applied)
+	assert.True(t, tableExists(t, conn, "users"))
+
+	again, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, again, "a migrated database has nothing pending")
+
+	rolledBack, err := m.Down(ctx, len(applied))
+	require.NoError(t, err)
+	require.Len(t, rolledBack, len(applied))
+	assert.Equal(t, applied[len(applied)-1].Version, rolledBack[0].Version, "rolls back newest first")
+	assert.False(t, tableExists(t, conn, "users"))
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.Nil(t, s.AppliedAt, "migration %d_%s", s.Version, s.Name)
+	}
+
+	reapplied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, reapplied, len(applied))
+}
+
+func TestMigrator_RejectsEditedMigration(t *testing.T) {
+	conn := connect(t)()
+	ctx := context.Background()
+
+	original, err := migrate.NewFS(conn, fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("CREATE TABLE t (b INT);")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+	})
+	require.NoError(t, err)
+	_, err = original.Up(ctx)
+	require.NoError(t, err)
+
+	edited, err := migrate.NewFS(conn, fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("CREATE TABLE t (b BIGINT);")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+		"0002_next.up.sql":   {Data: []byte("CREATE TABLE u (c INT);")},
+		"0002_next.down.sql": {Data: []byte("DROP TABLE u;")},
+	})
+	require.NoError(t, err)
+	_, err = edited.Up(ctx)
+	assert.ErrorIs(t, err, migrate.ErrChecksumMismatch)
+	_, err = edited.Down(ctx, 1)
+	assert.ErrorIs(t, err, migrate.ErrChecksumMismatch)
+	assert.False(t, tableExists(t, conn, "u"), "nothing is applied past a modified migration")
+
+	older, err := migrate.NewFS(conn, fstest.MapFS{})
+	require.NoError(t, err)
+	_, err = older.Up(ctx)
+	assert.ErrorIs(t, err, migrate.ErrUnknownVersion)
+}
+
+func TestMigrator_ConcurrentUpIsSerialized(t *testing.T) {
+	connFor := connect(t)
+	ctx := context.Background()
+	// The sleep holds the first run inside the lock long enough for the
+	// second to queue behind it; without the lock both would create t.
+	fsys := fstest.MapFS{
+		"0001_init.up.sql":   {Data: []byte("SELECT pg_sleep(0.2); CREATE TABLE t (b INT);")},
+		"0001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+		"0002_next.up.sql":   {Data: []byte("CREATE TABLE u (c INT);")},
+		"0002_next.down.sql": {Data: []byte("DROP TABLE u;")},
+	}
+
+	const runs = 2
+	var wg sync.WaitGroup
+	applied := make([][]migrate.Migration, runs)
+	errs := make([]error, runs)
+	for i := range runs {
+		m, err := migrate.NewFS(connFor(), fsys)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = m.Up(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, len(applied[0])+len(applied[1]), "every migration is applied exactly once")
+	assert.True(t, len(applied[0]) == 0 || len(applied[1]) == 0, "one run applies everything, the other finds nothing pending")
+}
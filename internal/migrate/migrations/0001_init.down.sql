@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS Purchases;
+DROP TABLE IF EXISTS User_Sticker_Progress;
+DROP TABLE IF EXISTS Sticker_Level_Requirements;
+DROP TABLE IF EXISTS Stores;
+DROP TABLE IF EXISTS Users;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS Users (
+	user_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	username VARCHAR(50) NOT NULL,
+	email VARCHAR(100),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS Stores (
+	store_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	store_name VARCHAR(100) NOT NULL,
+	location VARCHAR(255),
+	sticker_theme VARCHAR(100),
+	is_active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE IF NOT EXISTS Sticker_Level_Requirements (
+	level VARCHAR(20) PRIMARY KEY,
+	stars_required INT,
+	next_level VARCHAR(20) REFERENCES Sticker_Level_Requirements(level) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE TABLE IF NOT EXISTS User_Sticker_Progress (
+	user_sticker_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES Users(user_id),
+	store_id UUID NOT NULL REFERENCES Stores(store_id),
+	current_level VARCHAR(20) NOT NULL REFERENCES Sticker_Level_Requirements(level),
+	star_count INT NOT NULL DEFAULT 0,
+	last_updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, store_id)
+);
+
+CREATE TABLE IF NOT EXISTS Purchases (
+	purchase_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES Users(user_id),
+	store_id UUID NOT NULL REFERENCES Stores(store_id),
+	purchase_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	source VARCHAR(50)
+);
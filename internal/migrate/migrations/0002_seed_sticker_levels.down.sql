@@ -0,0 +1 @@
+DELETE FROM Sticker_Level_Requirements WHERE level IN ('bronze', 'silver', 'gold', 'platinum');
@@ -0,0 +1,6 @@
+INSERT INTO Sticker_Level_Requirements (level, stars_required, next_level) VALUES
+	('bronze', 5, 'silver'),
+	('silver', 5, 'gold'),
+	('gold', 5, 'platinum'),
+	('platinum', NULL, NULL)
+ON CONFLICT (level) DO NOTHING;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS Purchase_Idempotency_Keys;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS Purchase_Idempotency_Keys (
+	idempotency_key VARCHAR(255) PRIMARY KEY,
+	request_hash CHAR(64) NOT NULL,
+	response_body BYTEA NOT NULL,
+	purchase_id UUID NOT NULL REFERENCES Purchases(purchase_id),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
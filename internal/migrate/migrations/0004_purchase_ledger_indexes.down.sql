@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS purchases_store_time_idx;
+DROP INDEX IF EXISTS purchases_user_time_idx;
+
+ALTER TABLE Purchases ALTER COLUMN source DROP NOT NULL;
+ALTER TABLE Purchases ALTER COLUMN source DROP DEFAULT;
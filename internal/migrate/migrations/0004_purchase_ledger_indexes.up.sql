@@ -0,0 +1,6 @@
+UPDATE Purchases SET source = 'app' WHERE source IS NULL;
+ALTER TABLE Purchases ALTER COLUMN source SET DEFAULT 'app';
+ALTER TABLE Purchases ALTER COLUMN source SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS purchases_user_time_idx ON Purchases (user_id, purchase_time DESC, purchase_id DESC);
+CREATE INDEX IF NOT EXISTS purchases_store_time_idx ON Purchases (store_id, purchase_time DESC, purchase_id DESC);
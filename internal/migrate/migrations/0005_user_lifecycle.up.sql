@@ -0,0 +1,14 @@
+ALTER TABLE Users ADD CONSTRAINT users_username_key UNIQUE (username);
+
+-- Deleting a user removes their stickers and purchase ledger with them.
+ALTER TABLE User_Sticker_Progress DROP CONSTRAINT user_sticker_progress_user_id_fkey;
+ALTER TABLE User_Sticker_Progress ADD CONSTRAINT user_sticker_progress_user_id_fkey
+	FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE;
+
+ALTER TABLE Purchases DROP CONSTRAINT purchases_user_id_fkey;
+ALTER TABLE Purchases ADD CONSTRAINT purchases_user_id_fkey
+	FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE;
+
+ALTER TABLE Purchase_Idempotency_Keys DROP CONSTRAINT purchase_idempotency_keys_purchase_id_fkey;
+ALTER TABLE Purchase_Idempotency_Keys ADD CONSTRAINT purchase_idempotency_keys_purchase_id_fkey
+	FOREIGN KEY (purchase_id) REFERENCES Purchases(purchase_id) ON DELETE CASCADE;
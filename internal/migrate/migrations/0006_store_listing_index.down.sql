@@ -0,0 +1 @@
+DROP INDEX IF EXISTS stores_name_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS stores_name_idx ON Stores (store_name, store_id);
@@ -0,0 +1,3 @@
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON Users (lower(email));
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS Refresh_Tokens;
+
+ALTER TABLE Users DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,11 @@
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS password_hash VARCHAR(100);
+
+CREATE TABLE IF NOT EXISTS Refresh_Tokens (
+	token_hash CHAR(64) PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON Refresh_Tokens (user_id);
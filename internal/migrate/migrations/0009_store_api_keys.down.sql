@@ -0,0 +1 @@
+DROP TABLE IF EXISTS Store_Api_Keys;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS Store_Api_Keys (
+	key_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	store_id UUID NOT NULL REFERENCES Stores(store_id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	key_hash CHAR(64) NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS store_api_keys_store_idx ON Store_Api_Keys (store_id, created_at);
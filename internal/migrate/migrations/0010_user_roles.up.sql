@@ -0,0 +1,16 @@
+-- Every user is a customer; rows here grant the roles beyond that.
+-- Store operators are scoped to one store per row, admins to none.
+CREATE TABLE IF NOT EXISTS User_Roles (
+	role_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES Users(user_id) ON DELETE CASCADE,
+	role VARCHAR(20) NOT NULL,
+	store_id UUID REFERENCES Stores(store_id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK (
+		(role = 'admin' AND store_id IS NULL) OR
+		(role = 'store_operator' AND store_id IS NOT NULL)
+	)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_roles_assignment_key
+	ON User_Roles (user_id, role, COALESCE(store_id, '00000000-0000-0000-0000-000000000000'));
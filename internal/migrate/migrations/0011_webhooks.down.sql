@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS Webhook_Deliveries;
+DROP TABLE IF EXISTS Webhooks;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS Webhooks (
+	webhook_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	store_id UUID NOT NULL REFERENCES Stores(store_id) ON DELETE CASCADE,
+	url VARCHAR(2048) NOT NULL,
+	event_types TEXT[] NOT NULL,
+	secret VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_store_idx ON Webhooks (store_id, created_at);
+
+CREATE TABLE IF NOT EXISTS Webhook_Deliveries (
+	delivery_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	webhook_id UUID NOT NULL REFERENCES Webhooks(webhook_id) ON DELETE CASCADE,
+	event_type VARCHAR(50) NOT NULL,
+	payload JSONB NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_status_code INT,
+	last_error TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	delivered_at TIMESTAMP
+);
+
+-- Only pending deliveries are ever polled.
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON Webhook_Deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_log_idx ON Webhook_Deliveries (webhook_id, created_at, delivery_id);
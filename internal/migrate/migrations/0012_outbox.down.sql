@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS webhook_deliveries_outbox_key;
+ALTER TABLE Webhook_Deliveries DROP COLUMN IF EXISTS outbox_id;
+DROP TABLE IF EXISTS Outbox;
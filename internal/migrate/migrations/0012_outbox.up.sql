@@ -0,0 +1,21 @@
+-- Sticker events are written here in the transaction that caused them and
+-- published by a relay afterwards, so none is lost if the process dies in
+-- between. outbox_id orders them; a user's events are numbered in the order
+-- their transactions commit.
+CREATE TABLE IF NOT EXISTS Outbox (
+	outbox_id BIGSERIAL PRIMARY KEY,
+	event_type VARCHAR(50) NOT NULL,
+	user_id UUID NOT NULL,
+	store_id UUID NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	sent_at TIMESTAMP
+);
+
+-- Only unsent events are ever polled.
+CREATE INDEX IF NOT EXISTS outbox_unsent_idx ON Outbox (outbox_id) WHERE sent_at IS NULL;
+
+-- A relay that stops before marking an event sent publishes it again; the
+-- key keeps that from queueing a second delivery per webhook.
+ALTER TABLE Webhook_Deliveries ADD COLUMN IF NOT EXISTS outbox_id BIGINT;
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_outbox_key ON Webhook_Deliveries (webhook_id, outbox_id);
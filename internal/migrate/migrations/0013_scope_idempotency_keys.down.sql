@@ -0,0 +1,8 @@
+-- Keys shared by several callers keep only their newest response.
+DELETE FROM Purchase_Idempotency_Keys k USING Purchase_Idempotency_Keys newer
+WHERE newer.idempotency_key = k.idempotency_key
+	AND (newer.created_at, newer.scope) > (k.created_at, k.scope);
+
+ALTER TABLE Purchase_Idempotency_Keys DROP CONSTRAINT purchase_idempotency_keys_pkey;
+ALTER TABLE Purchase_Idempotency_Keys DROP COLUMN IF EXISTS scope;
+ALTER TABLE Purchase_Idempotency_Keys ADD PRIMARY KEY (idempotency_key);
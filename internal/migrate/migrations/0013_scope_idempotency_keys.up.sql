@@ -0,0 +1,15 @@
+-- Idempotency keys are chosen by clients, so two callers may pick the same
+-- one. Each key now belongs to the caller that sent it: "user:<user_id>" for
+-- users and "api_key:<key_id>" for store terminals.
+ALTER TABLE Purchase_Idempotency_Keys ADD COLUMN IF NOT EXISTS scope VARCHAR(100);
+
+UPDATE Purchase_Idempotency_Keys k SET scope = CASE
+	WHEN p.source LIKE 'pos:%' THEN 'api_key:' || substr(p.source, 5)
+	ELSE 'user:' || p.user_id
+END
+FROM Purchases p
+WHERE p.purchase_id = k.purchase_id AND k.scope IS NULL;
+
+ALTER TABLE Purchase_Idempotency_Keys ALTER COLUMN scope SET NOT NULL;
+ALTER TABLE Purchase_Idempotency_Keys DROP CONSTRAINT purchase_idempotency_keys_pkey;
+ALTER TABLE Purchase_Idempotency_Keys ADD PRIMARY KEY (scope, idempotency_key);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_sent_idx;
+DROP INDEX IF EXISTS outbox_unsent_user_idx;
+ALTER TABLE Outbox DROP COLUMN IF EXISTS claimed_until;
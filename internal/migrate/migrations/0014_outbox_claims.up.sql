@@ -0,0 +1,9 @@
+-- Relays claim messages for a while instead of holding a transaction open
+-- while they publish; a claim that runs out is picked up again.
+ALTER TABLE Outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
+
+-- Claims skip users whose earlier messages are still out with another relay.
+CREATE INDEX IF NOT EXISTS outbox_unsent_user_idx ON Outbox (user_id, outbox_id) WHERE sent_at IS NULL;
+
+-- Sent messages are deleted once they are older than the retention period.
+CREATE INDEX IF NOT EXISTS outbox_sent_idx ON Outbox (sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,17 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/m-garey/fetchit-backend/internal/mailer"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	args := m.Called(ctx, msg)
+	return args.Error(0)
+}
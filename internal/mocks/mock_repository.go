@@ -2,6 +2,9 @@
 package mocks
 
 import (
+	"context"
+	"time"
+
 	"github.com/m-garey/fetchit-backend/internal/models"
 	"github.com/stretchr/testify/mock"
 )
@@ -10,32 +13,222 @@ type MockRepository struct {
 	mock.Mock
 }
 
-func (m *MockRepository) CreateTables() error {
-	args := m.Called()
+func (m *MockRepository) InsertUser(ctx context.Context, req models.UserRequest) (models.UserResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(models.UserResponse), args.Error(1)
+}
+
+func (m *MockRepository) GetUser(ctx context.Context, userID string) (models.User, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockRepository) UpdateUser(ctx context.Context, userID string, req models.UserUpdateRequest) (models.User, error) {
+	args := m.Called(ctx, userID, req)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockRepository) DeleteUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
 	return args.Error(0)
 }
 
-func (m *MockRepository) InsertUser(req models.UserRequest) (models.UserResponse, error) {
-	args := m.Called(req)
-	return args.Get(0).(models.UserResponse), args.Error(1)
+func (m *MockRepository) ListUsers(ctx context.Context, filter models.UserFilter) (models.UserListResponse, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(models.UserListResponse), args.Error(1)
+}
+
+func (m *MockRepository) UpdateEmail(ctx context.Context, userID, email string) (models.User, error) {
+	args := m.Called(ctx, userID, email)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockRepository) VerifyEmail(ctx context.Context, userID, email string) (models.User, error) {
+	args := m.Called(ctx, userID, email)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockRepository) CreateAccount(ctx context.Context, req models.SignupRequest, passwordHash string) (models.User, error) {
+	args := m.Called(ctx, req, passwordHash)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockRepository) GetCredentials(ctx context.Context, username string) (models.Credentials, error) {
+	args := m.Called(ctx, username)
+	return args.Get(0).(models.Credentials), args.Error(1)
+}
+
+func (m *MockRepository) CreateRefreshToken(ctx context.Context, userID, tokenHash string, ttl time.Duration) error {
+	args := m.Called(ctx, userID, tokenHash, ttl)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RotateRefreshToken(ctx context.Context, oldHash, newHash string, ttl time.Duration) (string, error) {
+	args := m.Called(ctx, oldHash, newHash, ttl)
+	return args.String(0), args.Error(1)
 }
 
-func (m *MockRepository) InsertStore(req models.StoreRequest) (models.StoreResponse, error) {
-	args := m.Called(req)
+func (m *MockRepository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	args := m.Called(ctx, tokenHash)
+	return args.Error(0)
+}
+
+func (m *MockRepository) InsertStore(ctx context.Context, req models.StoreRequest) (models.StoreResponse, error) {
+	args := m.Called(ctx, req)
 	return args.Get(0).(models.StoreResponse), args.Error(1)
 }
 
-func (m *MockRepository) UpsertStar(req models.PurchaseRequest) (models.PurchaseResponse, error) {
-	args := m.Called(req)
+func (m *MockRepository) GetStore(ctx context.Context, storeID string) (models.Store, error) {
+	args := m.Called(ctx, storeID)
+	return args.Get(0).(models.Store), args.Error(1)
+}
+
+func (m *MockRepository) UpdateStore(ctx context.Context, storeID string, req models.StoreUpdateRequest) (models.Store, error) {
+	args := m.Called(ctx, storeID, req)
+	return args.Get(0).(models.Store), args.Error(1)
+}
+
+func (m *MockRepository) SetStoreActive(ctx context.Context, storeID string, active bool) (models.Store, error) {
+	args := m.Called(ctx, storeID, active)
+	return args.Get(0).(models.Store), args.Error(1)
+}
+
+func (m *MockRepository) ListStores(ctx context.Context, filter models.StoreFilter) (models.StoreListResponse, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(models.StoreListResponse), args.Error(1)
+}
+
+func (m *MockRepository) GetStoreStats(ctx context.Context, storeID string) (models.StoreStats, error) {
+	args := m.Called(ctx, storeID)
+	return args.Get(0).(models.StoreStats), args.Error(1)
+}
+
+func (m *MockRepository) ListRoles(ctx context.Context, userID string) (models.Roles, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(models.Roles), args.Error(1)
+}
+
+func (m *MockRepository) AssignRole(ctx context.Context, userID string, req models.RoleRequest) (models.RoleAssignment, error) {
+	args := m.Called(ctx, userID, req)
+	return args.Get(0).(models.RoleAssignment), args.Error(1)
+}
+
+func (m *MockRepository) RevokeRole(ctx context.Context, userID, roleID string) error {
+	args := m.Called(ctx, userID, roleID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListLevels(ctx context.Context) (models.LevelListResponse, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(models.LevelListResponse), args.Error(1)
+}
+
+func (m *MockRepository) UpdateLevel(ctx context.Context, level string, req models.LevelUpdateRequest) (models.StickerLevelRequirement, error) {
+	args := m.Called(ctx, level, req)
+	return args.Get(0).(models.StickerLevelRequirement), args.Error(1)
+}
+
+func (m *MockRepository) CreateAPIKey(ctx context.Context, storeID string, req models.APIKeyRequest, keyHash string) (models.APIKey, error) {
+	args := m.Called(ctx, storeID, req, keyHash)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+
+func (m *MockRepository) ListAPIKeys(ctx context.Context, storeID string) (models.APIKeyListResponse, error) {
+	args := m.Called(ctx, storeID)
+	return args.Get(0).(models.APIKeyListResponse), args.Error(1)
+}
+
+func (m *MockRepository) RevokeAPIKey(ctx context.Context, storeID, keyID string) error {
+	args := m.Called(ctx, storeID, keyID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) AuthenticateAPIKey(ctx context.Context, keyHash string) (models.APIKey, error) {
+	args := m.Called(ctx, keyHash)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+
+func (m *MockRepository) CreateWebhook(ctx context.Context, storeID string, req models.WebhookRequest, secret string) (models.Webhook, error) {
+	args := m.Called(ctx, storeID, req, secret)
+	return args.Get(0).(models.Webhook), args.Error(1)
+}
+
+func (m *MockRepository) ListWebhooks(ctx context.Context, storeID string) (models.WebhookListResponse, error) {
+	args := m.Called(ctx, storeID)
+	return args.Get(0).(models.WebhookListResponse), args.Error(1)
+}
+
+func (m *MockRepository) DeleteWebhook(ctx context.Context, storeID, webhookID string) error {
+	args := m.Called(ctx, storeID, webhookID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListWebhookDeliveries(ctx context.Context, storeID, webhookID string, filter models.WebhookDeliveryFilter) (models.WebhookDeliveryListResponse, error) {
+	args := m.Called(ctx, storeID, webhookID, filter)
+	return args.Get(0).(models.WebhookDeliveryListResponse), args.Error(1)
+}
+
+func (m *MockRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.DueWebhookDelivery, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]models.DueWebhookDelivery), args.Error(1)
+}
+
+func (m *MockRepository) RecordWebhookAttempt(ctx context.Context, deliveryID string, attempt models.WebhookAttempt) error {
+	args := m.Called(ctx, deliveryID, attempt)
+	return args.Error(0)
+}
+
+func (m *MockRepository) EnqueueWebhooks(ctx context.Context, message models.OutboxMessage) error {
+	args := m.Called(ctx, message)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]models.OutboxMessage), args.Error(1)
+}
+
+func (m *MockRepository) MarkOutboxSent(ctx context.Context, ids []int64) error {
+	args := m.Called(ctx, ids)
+	return args.Error(0)
+}
+
+func (m *MockRepository) PruneOutbox(ctx context.Context, retention time.Duration, limit int) (int, error) {
+	args := m.Called(ctx, retention, limit)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) UpsertStar(ctx context.Context, req models.PurchaseRequest) (models.PurchaseResponse, error) {
+	args := m.Called(ctx, req)
 	return args.Get(0).(models.PurchaseResponse), args.Error(1)
 }
 
-func (m *MockRepository) GetSticker(userID, storeID string) (models.UserStickerResponse, error) {
-	args := m.Called(userID, storeID)
+func (m *MockRepository) UpsertStarOnce(ctx context.Context, req models.PurchaseRequest, key models.IdempotencyKey) (models.IdempotentPurchaseResponse, error) {
+	args := m.Called(ctx, req, key)
+	return args.Get(0).(models.IdempotentPurchaseResponse), args.Error(1)
+}
+
+func (m *MockRepository) GetSticker(ctx context.Context, userID, storeID string) (models.UserStickerResponse, error) {
+	args := m.Called(ctx, userID, storeID)
 	return args.Get(0).(models.UserStickerResponse), args.Error(1)
 }
 
-func (m *MockRepository) GetStickersByUser(userID string) (models.StickerByUserResponse, error) {
-	args := m.Called(userID)
+func (m *MockRepository) GetStickersByUser(ctx context.Context, userID string, filter models.StickerFilter) (models.StickerByUserResponse, error) {
+	args := m.Called(ctx, userID, filter)
 	return args.Get(0).(models.StickerByUserResponse), args.Error(1)
 }
+
+func (m *MockRepository) ListPurchasesByUser(ctx context.Context, userID string, filter models.PurchaseFilter) (models.PurchaseListResponse, error) {
+	args := m.Called(ctx, userID, filter)
+	return args.Get(0).(models.PurchaseListResponse), args.Error(1)
+}
+
+func (m *MockRepository) ListPurchasesByStore(ctx context.Context, storeID string, filter models.PurchaseFilter) (models.PurchaseListResponse, error) {
+	args := m.Called(ctx, storeID, filter)
+	return args.Get(0).(models.PurchaseListResponse), args.Error(1)
+}
+
+func (m *MockRepository) ReplayProgress(ctx context.Context, req models.ReplayRequest) (models.ReplayReport, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(models.ReplayReport), args.Error(1)
+}
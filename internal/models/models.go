@@ -1,21 +1,185 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+)
 
 // USER
 
 type User struct {
-	ID        string    `json:"user_id"`
-	Username  string    `json:"username"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            string    `json:"user_id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
+// Binding limits mirror the column sizes in the Users, Stores and Purchases
+// tables.
+
 type UserRequest struct {
-	Username string `json:"username"`
+	Username string `json:"username" binding:"required,max=50"`
+	Email    string `json:"email,omitempty" binding:"omitempty,email,max=100"`
+}
+
+// UnmarshalJSON trims the username and email so validation sees what will be
+// stored.
+func (r *UserRequest) UnmarshalJSON(data []byte) error {
+	type raw UserRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	r.Username = strings.TrimSpace(r.Username)
+	r.Email = strings.TrimSpace(r.Email)
+	return nil
 }
 
+// UserResponse is a created user. Email is the address stored on the account,
+// which the verification link is sent to.
 type UserResponse struct {
-	ID string `json:"user_id"`
+	ID    string `json:"user_id"`
+	Email string `json:"email,omitempty"`
+}
+
+// UserUpdateRequest is a partial update; nil fields are left unchanged.
+type UserUpdateRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=1,max=50"`
+}
+
+func (r *UserUpdateRequest) UnmarshalJSON(data []byte) error {
+	type raw UserUpdateRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	if r.Username != nil {
+		username := strings.TrimSpace(*r.Username)
+		r.Username = &username
+	}
+	return nil
+}
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email,max=100"`
+}
+
+func (r *EmailRequest) UnmarshalJSON(data []byte) error {
+	type raw EmailRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	r.Email = strings.TrimSpace(r.Email)
+	return nil
+}
+
+// VerifyEmailRequest carries the token from a verification link, either in
+// the query string or in a JSON body.
+type VerifyEmailRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+// UserFilter narrows a user listing to usernames containing Search.
+type UserFilter struct {
+	Search string
+	Page   pagination.Page
+}
+
+type UserListResponse struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// AUTH
+
+type SignupRequest struct {
+	Username string `json:"username" binding:"required,max=50"`
+	Email    string `json:"email,omitempty" binding:"omitempty,email,max=100"`
+	// bcrypt ignores everything past 72 bytes.
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+func (r *SignupRequest) UnmarshalJSON(data []byte) error {
+	type raw SignupRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	r.Username = strings.TrimSpace(r.Username)
+	r.Email = strings.TrimSpace(r.Email)
+	return nil
+}
+
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse is returned by signup, login and refresh. ExpiresIn is the
+// access token lifetime in seconds.
+type TokenResponse struct {
+	UserID       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Credentials is what a login password is checked against. PasswordHash is
+// empty for users created without a password.
+type Credentials struct {
+	UserID       string
+	PasswordHash string
+}
+
+// ROLE
+
+// Roles a user can hold. Every user is a customer; the other roles are
+// granted through RoleAssignments.
+const (
+	RoleCustomer      = "customer"
+	RoleStoreOperator = "store_operator"
+	RoleAdmin         = "admin"
+)
+
+// RoleAssignment grants a user a role. StoreID is set for store operators
+// only.
+type RoleAssignment struct {
+	ID        string    `json:"role_id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	StoreID   string    `json:"store_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RoleRequest struct {
+	Role    string `json:"role" binding:"required,oneof=store_operator admin"`
+	StoreID string `json:"store_id,omitempty" binding:"omitempty,uuid"`
+}
+
+type RoleListResponse struct {
+	Roles []RoleAssignment `json:"roles"`
+}
+
+// Roles are the role assignments of one user.
+type Roles []RoleAssignment
+
+func (r Roles) IsAdmin() bool {
+	return slices.ContainsFunc(r, func(a RoleAssignment) bool { return a.Role == RoleAdmin })
+}
+
+// Operates reports whether the user is a store operator of storeID.
+func (r Roles) Operates(storeID string) bool {
+	return slices.ContainsFunc(r, func(a RoleAssignment) bool {
+		return a.Role == RoleStoreOperator && a.StoreID == storeID
+	})
 }
 
 // STORE
@@ -29,14 +193,121 @@ type Store struct {
 }
 
 type StoreRequest struct {
-	Name     string `json:"store_name"`
-	Location string `json:"location"`
+	Name         string `json:"store_name" binding:"required,max=100"`
+	Location     string `json:"location" binding:"max=255"`
+	StickerTheme string `json:"sticker_theme,omitempty" binding:"max=100"`
+}
+
+func (r *StoreRequest) UnmarshalJSON(data []byte) error {
+	type raw StoreRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	r.Location = strings.TrimSpace(r.Location)
+	r.StickerTheme = strings.TrimSpace(r.StickerTheme)
+	return nil
 }
 
 type StoreResponse struct {
 	ID string `json:"store_id"`
 }
 
+// StoreUpdateRequest is a partial update; nil fields are left unchanged and
+// an empty location or sticker theme clears it.
+type StoreUpdateRequest struct {
+	Name         *string `json:"store_name" binding:"omitempty,min=1,max=100"`
+	Location     *string `json:"location" binding:"omitempty,max=255"`
+	StickerTheme *string `json:"sticker_theme" binding:"omitempty,max=100"`
+}
+
+func (r *StoreUpdateRequest) UnmarshalJSON(data []byte) error {
+	type raw StoreUpdateRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	for _, field := range []**string{&r.Name, &r.Location, &r.StickerTheme} {
+		if *field != nil {
+			v := strings.TrimSpace(**field)
+			*field = &v
+		}
+	}
+	return nil
+}
+
+// StoreFilter narrows a store listing. A nil Active lists stores in either
+// state; Search matches any part of the store name.
+type StoreFilter struct {
+	Active       *bool
+	StickerTheme string
+	Search       string
+	Page         pagination.Page
+}
+
+type StoreListResponse struct {
+	Stores     []Store `json:"stores"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// StoreStats summarizes a store's purchase ledger and the stickers its
+// customers hold.
+type StoreStats struct {
+	StoreID             string         `json:"store_id"`
+	Purchases           int            `json:"purchases"`
+	PurchasesLast30Days int            `json:"purchases_last_30_days"`
+	Customers           int            `json:"customers"`
+	StickersByLevel     map[string]int `json:"stickers_by_level"`
+}
+
+// STORE API KEY
+
+// Scopes a store API key can be granted.
+const (
+	ScopePurchasesWrite = "purchases:write"
+	ScopePurchasesRead  = "purchases:read"
+)
+
+// APIKey authenticates a store's point-of-sale terminals. Only a hash of the
+// key itself is stored, so it is returned once, in APIKeyResponse.
+type APIKey struct {
+	ID         string     `json:"key_id"`
+	StoreID    string     `json:"store_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// APIKeyRequest issues a key. Scopes defaults to purchases:write.
+type APIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes,omitempty" binding:"omitempty,max=2,dive,oneof=purchases:write purchases:read"`
+}
+
+func (r *APIKeyRequest) UnmarshalJSON(data []byte) error {
+	type raw APIKeyRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	return nil
+}
+
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	APIKeys []APIKey `json:"api_keys"`
+}
+
 // STICKER
 
 type UserStickerProgress struct {
@@ -48,45 +319,288 @@ type UserStickerProgress struct {
 	LastUpdated  time.Time `json:"last_updated"`
 }
 
+// PurchaseSourceApp is recorded when a purchase request does not name its
+// source channel. Purchases made with a store API key are recorded as
+// PurchaseSourcePOS followed by the key ID.
+const (
+	PurchaseSourceApp = "app"
+	PurchaseSourcePOS = "pos:"
+)
+
 type Purchase struct {
 	ID           string    `json:"purchase_id"`
 	UserID       string    `json:"user_id"`
 	StoreID      string    `json:"store_id"`
 	PurchaseTime time.Time `json:"purchase_time"`
+	Source       string    `json:"source"`
 }
 
+// PurchaseRequest records a purchase. UserID defaults to the authenticated
+// user and is required when a store API key records the purchase.
 type PurchaseRequest struct {
-	UserID  string `json:"user_id"`
-	StoreID string `json:"store_id"`
+	UserID  string `json:"user_id,omitempty" binding:"omitempty,uuid"`
+	StoreID string `json:"store_id" binding:"required,uuid"`
+	Source  string `json:"source,omitempty" binding:"max=50"`
 }
 
+// PurchaseFilter narrows a ledger listing to purchases made in [From, To).
+type PurchaseFilter struct {
+	From *time.Time
+	To   *time.Time
+	Page pagination.Page
+}
+
+type PurchaseListResponse struct {
+	Purchases  []Purchase `json:"purchases"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// PurchaseResponse is the sticker after the purchase's star. NewSticker is set
+// on the user's first purchase at the store.
 type PurchaseResponse struct {
-	LevelUp   bool   `json:"level_up"`
+	LevelUp    bool   `json:"level_up"`
+	Level      string `json:"level"`
+	StarCount  int    `json:"star_count"`
+	NewSticker bool   `json:"new_sticker"`
+}
+
+// Sticker event types streamed to a user. Every purchase awards a star; a
+// level_up follows when that star completed a level.
+const (
+	EventStarAwarded = "star_awarded"
+	EventLevelUp     = "level_up"
+)
+
+// StickerEvent is the data of a sticker event: the user's sticker at a store
+// right after the purchase.
+type StickerEvent struct {
+	UserID    string `json:"user_id"`
+	StoreID   string `json:"store_id"`
 	Level     string `json:"level"`
 	StarCount int    `json:"star_count"`
 }
 
+// IdempotencyKey identifies a client retry of the same purchase. Scope names
+// the caller the key belongs to, so callers that pick the same key do not see
+// each other's responses. RequestHash is the SHA-256 of the normalized request
+// body.
+type IdempotencyKey struct {
+	Scope       string
+	Key         string
+	RequestHash string
+}
+
+// IdempotentPurchaseResponse carries the stored JSON body of the original
+// PurchaseResponse so replays can return it unchanged.
+type IdempotentPurchaseResponse struct {
+	Body     []byte
+	Replayed bool
+}
+
 type StickerLevelRequirement struct {
 	Level         string `json:"level"`
 	StarsRequired int    `json:"stars_required"`
 	NextLevel     string `json:"next_level"`
 }
 
+type LevelListResponse struct {
+	Levels []StickerLevelRequirement `json:"levels"`
+}
+
+// LevelUpdateRequest changes how many stars it takes to leave a level.
+type LevelUpdateRequest struct {
+	StarsRequired int `json:"stars_required" binding:"required,min=1,max=1000"`
+}
+
+// WEBHOOK
+
+// Webhook posts a store's sticker events to a partner's URL. Deliveries are
+// signed with a secret that is only returned once, in WebhookResponse.
+type Webhook struct {
+	ID         string    `json:"webhook_id"`
+	StoreID    string    `json:"store_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookRequest struct {
+	URL        string   `json:"url" binding:"required,http_url,max=2048"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,max=2,dive,oneof=star_awarded level_up"`
+}
+
+func (r *WebhookRequest) UnmarshalJSON(data []byte) error {
+	type raw WebhookRequest
+	if err := json.Unmarshal(data, (*raw)(r)); err != nil {
+		return err
+	}
+	r.URL = strings.TrimSpace(r.URL)
+	return nil
+}
+
+type WebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookListResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// Webhook delivery states. A pending delivery is retried with backoff until it
+// is delivered or runs out of attempts and is dead-lettered.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event on its way to a webhook. Payload is the event
+// data; it is sent wrapped in an envelope naming the delivery and event type.
+type WebhookDelivery struct {
+	ID             string          `json:"delivery_id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookDeliveryFilter narrows a delivery log to one status.
+type WebhookDeliveryFilter struct {
+	Status string
+	Page   pagination.Page
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// DueWebhookDelivery is a claimed delivery with what is needed to send it.
+type DueWebhookDelivery struct {
+	ID        string
+	EventType string
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+	URL       string
+	Secret    string
+}
+
+// WebhookAttempt is the outcome of sending a delivery. Status is the state the
+// delivery moves to; a pending delivery is retried after RetryIn.
+type WebhookAttempt struct {
+	Status     string
+	StatusCode int
+	Error      string
+	RetryIn    time.Duration
+}
+
+// OUTBOX
+
+// OutboxMessage is a sticker event written with the purchase that caused it,
+// waiting to be published. Payload is the event data, a StickerEvent.
+type OutboxMessage struct {
+	ID        int64
+	EventType string
+	UserID    string
+	StoreID   string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// REPLAY
+
+// ReplayRequest scopes a rebuild of sticker progress from the purchase ledger.
+// Leaving both IDs empty rebuilds every sticker. Stickers with no purchases in
+// the ledger, such as those earned before it existed, are only deleted when
+// DeleteWithoutHistory is set.
+type ReplayRequest struct {
+	UserID               string `json:"user_id,omitempty" binding:"omitempty,uuid"`
+	StoreID              string `json:"store_id,omitempty" binding:"omitempty,uuid"`
+	DryRun               bool   `json:"dry_run"`
+	DeleteWithoutHistory bool   `json:"delete_without_history"`
+}
+
+type StickerState struct {
+	Level     string `json:"level"`
+	StarCount int    `json:"star_count"`
+}
+
+// StickerDiff describes one sticker whose stored progress disagrees with the
+// ledger. Before is nil for stickers that are missing. After is nil and
+// NoLedgerHistory set for stickers that have no purchases behind them.
+type StickerDiff struct {
+	UserID          string        `json:"user_id"`
+	StoreID         string        `json:"store_id"`
+	Before          *StickerState `json:"before"`
+	After           *StickerState `json:"after"`
+	NoLedgerHistory bool          `json:"no_ledger_history,omitempty"`
+}
+
+type ReplayReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Scanned int           `json:"scanned"`
+	Changed int           `json:"changed"`
+	Diffs   []StickerDiff `json:"diffs"`
+}
+
 // Get sticker for user for specific store
 
+// UserStickerResponse is a sticker with the store it was collected at and the
+// user's progress towards its next level. NextLevel is empty and
+// StarsToNextLevel zero once the last level is reached.
 type UserStickerResponse struct {
-	StoreName string `json:"store_name"`
-	Location  string `json:"location"`
-	StarCount int    `json:"star_count"`
-	Level     string `json:"level"`
+	StickerID        string    `json:"sticker_id"`
+	StoreID          string    `json:"store_id"`
+	StoreName        string    `json:"store_name"`
+	Location         string    `json:"location"`
+	StickerTheme     string    `json:"sticker_theme"`
+	StarCount        int       `json:"star_count"`
+	Level            string    `json:"level"`
+	NextLevel        string    `json:"next_level,omitempty"`
+	StarsToNextLevel int       `json:"stars_to_next_level"`
+	LastUpdated      time.Time `json:"last_updated"`
+}
+
+// Orders a user's sticker listing can be sorted in.
+const (
+	StickerSortLevel       = "level"
+	StickerSortStarCount   = "star_count"
+	StickerSortLastUpdated = "last_updated"
+)
+
+// StickerFilter narrows and orders a user's sticker listing. Level sorts by
+// position in the level chain rather than by name.
+type StickerFilter struct {
+	Level        string
+	StickerTheme string
+	Sort         string
+	Descending   bool
+	Page         pagination.Page
 }
 
+// StickerByUserResponse is one page of a user's stickers. Total counts every
+// sticker matching the filter, across all pages.
 type StickerByUserResponse struct {
-	Stickers []UserStickerResponse `json:"stickers"`
+	Stickers   []UserStickerResponse `json:"stickers"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	Total      int                   `json:"total"`
 }
 
 // ERROR
 
+// ErrorResponse is the body of every non-2xx API response. Code is the
+// machine-readable error kind, e.g. "not_found" or "conflict". Details lists
+// the offending fields of a rejected request.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error   string              `json:"error"`
+	Code    string              `json:"code,omitempty"`
+	Details []apperr.FieldError `json:"details,omitempty"`
 }
@@ -0,0 +1,218 @@
+// Package outbox publishes the sticker events that purchases write to the
+// outbox table once their transaction has committed, so an event is neither
+// lost when the process dies nor sent for a purchase that rolled back.
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/m-garey/fetchit-backend/internal/events"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+const (
+	defaultPollInterval = 500 * time.Millisecond
+	defaultLease        = 30 * time.Second
+	defaultRetention    = 7 * 24 * time.Hour
+	pruneInterval       = 10 * time.Minute
+	batchSize           = 100
+	pruneBatchSize      = 1000
+)
+
+// Store is where the outbox is kept. repository.Repository implements it.
+type Store interface {
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, ids []int64) error
+	PruneOutbox(ctx context.Context, retention time.Duration, limit int) (int, error)
+}
+
+// Publisher sends a message on. A message is published at least once: it is
+// published again if its claim runs out before the relay marks it sent.
+type Publisher interface {
+	Publish(ctx context.Context, message models.OutboxMessage) error
+}
+
+type PublisherFunc func(ctx context.Context, message models.OutboxMessage) error
+
+func (f PublisherFunc) Publish(ctx context.Context, message models.OutboxMessage) error {
+	return f(ctx, message)
+}
+
+// Publishers publishes to each publisher in turn, stopping at the first
+// error. A failed message is published to all of them again, so publishers
+// that may fail should come first.
+type Publishers []Publisher
+
+func (p Publishers) Publish(ctx context.Context, message models.OutboxMessage) error {
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bus publishes to the in-process event bus, for the streams and WebSockets
+// following the user or the store.
+func Bus(bus *events.Bus) Publisher {
+	return PublisherFunc(func(_ context.Context, message models.OutboxMessage) error {
+		bus.Publish(message.EventType, message.Payload, events.User(message.UserID), events.Store(message.StoreID))
+		return nil
+	})
+}
+
+// WebhookQueue queues webhook deliveries. repository.Repository implements
+// it.
+type WebhookQueue interface {
+	EnqueueWebhooks(ctx context.Context, message models.OutboxMessage) error
+}
+
+// Webhooks queues a delivery for every webhook of the store that asked for
+// the event.
+func Webhooks(queue WebhookQueue) Publisher {
+	return PublisherFunc(queue.EnqueueWebhooks)
+}
+
+// Log writes every message to logger.
+func Log(logger *slog.Logger) Publisher {
+	return PublisherFunc(func(ctx context.Context, message models.OutboxMessage) error {
+		logger.InfoContext(ctx, "outbox message",
+			"event_type", message.EventType,
+			"outbox_id", message.ID,
+			"user_id", message.UserID,
+			"store_id", message.StoreID,
+			"payload", message.Payload)
+		return nil
+	})
+}
+
+// Relay polls the outbox and publishes what it finds. It claims messages and
+// marks them sent in short transactions of their own and publishes in
+// between, so a slow publisher holds no transaction open.
+type Relay struct {
+	store        Store
+	publisher    Publisher
+	pollInterval time.Duration
+	lease        time.Duration
+	retention    time.Duration
+	lastPruned   time.Time
+}
+
+type Option func(*Relay)
+
+// WithPollInterval sets how long the relay idles when the outbox is empty.
+func WithPollInterval(interval time.Duration) Option {
+	return func(r *Relay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithLease sets how long claimed messages are held. It should outlast
+// publishing a batch; a message that fails to publish is retried once it runs
+// out.
+func WithLease(lease time.Duration) Option {
+	return func(r *Relay) {
+		r.lease = lease
+	}
+}
+
+// WithRetention sets how long sent messages are kept before they are deleted.
+func WithRetention(retention time.Duration) Option {
+	return func(r *Relay) {
+		r.retention = retention
+	}
+}
+
+func NewRelay(store Store, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:        store,
+		publisher:    publisher,
+		pollInterval: defaultPollInterval,
+		lease:        defaultLease,
+		retention:    defaultRetention,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run relays until ctx is cancelled, pruning sent messages every few minutes.
+// A batch already started is finished and marked sent first, so stopping does
+// not publish anything twice.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.RelayOnce(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.Error("relaying outbox messages failed", "error", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(r.lastPruned) >= pruneInterval {
+			r.lastPruned = time.Now()
+			if _, err := r.Prune(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("pruning the outbox failed", "error", err)
+			}
+		}
+		if n == batchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// RelayOnce publishes the oldest unsent messages and returns how many it
+// claimed.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := r.store.ClaimOutbox(ctx, batchSize, r.lease)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+	if sent := r.publish(ctx, messages); len(sent) > 0 {
+		if err := r.store.MarkOutboxSent(ctx, sent); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// Prune deletes the messages sent longer ago than the retention period and
+// returns how many it deleted.
+func (r *Relay) Prune(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := r.store.PruneOutbox(ctx, r.retention, pruneBatchSize)
+		total += n
+		if err != nil || n < pruneBatchSize {
+			return total, err
+		}
+	}
+}
+
+// publish returns the IDs of the messages it published. Once one of a user's
+// messages fails, their later ones wait with it until its claim runs out so
+// they are never published out of order.
+func (r *Relay) publish(ctx context.Context, messages []models.OutboxMessage) []int64 {
+	var sent []int64
+	failed := make(map[string]bool)
+	for _, message := range messages {
+		if failed[message.UserID] {
+			continue
+		}
+		if err := r.publisher.Publish(ctx, message); err != nil {
+			slog.ErrorContext(ctx, "publishing outbox message failed", "outbox_id", message.ID, "error", err)
+			failed[message.UserID] = true
+			continue
+		}
+		sent = append(sent, message.ID)
+	}
+	return sent
+}
@@ -0,0 +1,257 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-garey/fetchit-backend/internal/events"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps the outbox in a slice, oldest first. Claims expire by
+// the store's clock, which tests move forward by hand.
+type memoryStore struct {
+	mu       sync.Mutex
+	messages []models.OutboxMessage
+	sent     map[int64]time.Time
+	claimed  map[int64]time.Time
+	now      time.Time
+}
+
+func newMemoryStore(messages ...models.OutboxMessage) *memoryStore {
+	return &memoryStore{
+		messages: messages,
+		sent:     make(map[int64]time.Time),
+		claimed:  make(map[int64]time.Time),
+		now:      time.Now(),
+	}
+}
+
+func (s *memoryStore) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func (s *memoryStore) ClaimOutbox(_ context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := make(map[string]bool)
+	var claimed []models.OutboxMessage
+	for _, m := range s.messages {
+		if _, ok := s.sent[m.ID]; ok {
+			continue
+		}
+		if held[m.UserID] || s.claimed[m.ID].After(s.now) {
+			held[m.UserID] = true
+			continue
+		}
+		if len(claimed) < limit {
+			s.claimed[m.ID] = s.now.Add(lease)
+			claimed = append(claimed, m)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) MarkOutboxSent(_ context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.sent[id] = s.now
+		delete(s.claimed, id)
+	}
+	return nil
+}
+
+func (s *memoryStore) PruneOutbox(_ context.Context, retention time.Duration, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.messages[:0]
+	n := 0
+	for _, m := range s.messages {
+		sentAt, ok := s.sent[m.ID]
+		if ok && sentAt.Before(s.now.Add(-retention)) && n < limit {
+			delete(s.sent, m.ID)
+			n++
+			continue
+		}
+		kept = append(kept, m)
+	}
+	s.messages = kept
+	return n, nil
+}
+
+func message(id int64, userID string) models.OutboxMessage {
+	return models.OutboxMessage{
+		ID:        id,
+		EventType: models.EventStarAwarded,
+		UserID:    userID,
+		StoreID:   "corner-shop",
+		Payload:   json.RawMessage(`{"star_count":1}`),
+	}
+}
+
+// recorder publishes successfully except to the users in fail.
+type recorder struct {
+	mu        sync.Mutex
+	published []int64
+	fail      map[string]bool
+}
+
+func (r *recorder) Publish(_ context.Context, m models.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[m.UserID] {
+		return errors.New("unavailable")
+	}
+	r.published = append(r.published, m.ID)
+	return nil
+}
+
+func TestRelay_PublishesInOrderAndMarksSent(t *testing.T) {
+	store := newMemoryStore(message(1, "alice"), message(2, "bob"), message(3, "alice"))
+	pub := &recorder{}
+	relay := NewRelay(store, pub)
+
+	n, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []int64{1, 2, 3}, pub.published)
+
+	n, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, pub.published, 3)
+}
+
+func TestRelay_FailureHoldsBackTheUsersLaterMessages(t *testing.T) {
+	store := newMemoryStore(message(1, "alice"), message(2, "bob"), message(3, "alice"), message(4, "bob"))
+	pub := &recorder{fail: map[string]bool{"alice": true}}
+	relay := NewRelay(store, pub)
+
+	_, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 4}, pub.published)
+
+	pub.fail = nil
+	n, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n, "alice's messages are still claimed")
+
+	store.advance(defaultLease)
+	_, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 4, 1, 3}, pub.published)
+}
+
+func TestRelay_SkipsUsersWithClaimedMessages(t *testing.T) {
+	store := newMemoryStore(message(1, "alice"), message(2, "bob"), message(3, "alice"))
+	_, err := store.ClaimOutbox(context.Background(), 1, time.Minute)
+	require.NoError(t, err)
+	pub := &recorder{}
+
+	_, err = NewRelay(store, pub).RelayOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, pub.published, "alice's later message waits for the first")
+}
+
+func TestRelay_PrunesOnlyOldSentMessages(t *testing.T) {
+	store := newMemoryStore(message(1, "alice"), message(2, "bob"))
+	relay := NewRelay(store, &recorder{}, WithRetention(time.Hour))
+	_, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	store.messages = append(store.messages, message(3, "alice"))
+
+	n, err := relay.Prune(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	store.advance(2 * time.Hour)
+	n, err = relay.Prune(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []models.OutboxMessage{message(3, "alice")}, store.messages)
+}
+
+func TestPublishers_StopAtFirstError(t *testing.T) {
+	failing := &recorder{fail: map[string]bool{"alice": true}}
+	after := &recorder{}
+
+	err := Publishers{failing, after}.Publish(context.Background(), message(1, "alice"))
+	assert.Error(t, err)
+	assert.Empty(t, after.published)
+
+	require.NoError(t, Publishers{failing, after}.Publish(context.Background(), message(2, "bob")))
+	assert.Equal(t, []int64{2}, after.published)
+}
+
+func TestBus_PublishesToUserAndStore(t *testing.T) {
+	bus := events.New()
+	user, _ := bus.Subscribe(events.User("alice"), 0)
+	defer user.Close()
+	store, _ := bus.Subscribe(events.Store("corner-shop"), 0)
+	defer store.Close()
+
+	require.NoError(t, Bus(bus).Publish(context.Background(), message(1, "alice")))
+
+	for _, sub := range []*events.Subscription{user, store} {
+		e := <-sub.Events()
+		assert.Equal(t, models.EventStarAwarded, e.Type)
+		assert.Equal(t, json.RawMessage(`{"star_count":1}`), e.Data)
+	}
+}
+
+func TestLog_WritesMessage(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	require.NoError(t, Log(logger).Publish(context.Background(), message(7, "alice")))
+	assert.JSONEq(t, `{
+		"level": "INFO",
+		"msg": "outbox message",
+		"event_type": "star_awarded",
+		"outbox_id": 7,
+		"user_id": "alice",
+		"store_id": "corner-shop",
+		"payload": {"star_count": 1}
+	}`, buf.String())
+}
+
+func TestRelay_RunStopsWithContext(t *testing.T) {
+	pub := &recorder{}
+	relay := NewRelay(newMemoryStore(message(1, "alice")), pub, WithPollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		pub.mu.Lock()
+		defer pub.mu.Unlock()
+		return len(pub.published) == 1
+	}, 2*time.Second, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
@@ -0,0 +1,71 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var ErrInvalidCursor = apperr.Validation("invalid cursor")
+
+// Cursor is a keyset position: the sort value of the last row returned and its
+// ID as a tie-breaker. It travels to clients as an opaque string.
+type Cursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Page is the requested window: at most Limit rows after the After cursor.
+type Page struct {
+	Limit int
+	After *Cursor
+}
+
+func Encode(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func Decode(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Parse builds a Page from the raw limit and cursor query parameters. Empty
+// values fall back to DefaultLimit and the first page.
+func Parse(limit, cursor string) (Page, error) {
+	page := Page{Limit: DefaultLimit}
+
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Page{}, apperr.Validation(fmt.Sprintf("limit must be between 1 and %d", MaxLimit))
+		}
+		page.Limit = n
+	}
+
+	if cursor != "" {
+		c, err := Decode(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		page.After = &c
+	}
+
+	return page, nil
+}
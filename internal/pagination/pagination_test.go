@@ -0,0 +1,57 @@
+package pagination_test
+
+import (
+	"testing"
+
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := pagination.Cursor{Value: "2025-06-01T12:00:00Z", ID: "8a6e0804-2bd0-4672-b79d-d97027f9071a"}
+
+	got, err := pagination.Decode(pagination.Encode(c))
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, s := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		_, err := pagination.Decode(s)
+		assert.ErrorIs(t, err, pagination.ErrInvalidCursor, s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	page, err := pagination.Parse("", "")
+	require.NoError(t, err)
+	assert.Equal(t, pagination.DefaultLimit, page.Limit)
+	assert.Nil(t, page.After)
+
+	cursor := pagination.Cursor{Value: "3", ID: "abc"}
+	page, err = pagination.Parse("10", pagination.Encode(cursor))
+	require.NoError(t, err)
+	assert.Equal(t, 10, page.Limit)
+	assert.Equal(t, &cursor, page.After)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  string
+		cursor string
+	}{
+		{"zero limit", "0", ""},
+		{"limit above max", "201", ""},
+		{"non-numeric limit", "ten", ""},
+		{"garbage cursor", "", "%%%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pagination.Parse(tt.limit, tt.cursor)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package progression
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+var (
+	ErrNoLevels     = errors.New("no sticker levels defined")
+	ErrUnknownLevel = errors.New("unknown sticker level")
+)
+
+// Rules is a validated sticker level chain loaded from Sticker_Level_Requirements.
+// Every level points at its next level until a single terminal level is reached.
+type Rules struct {
+	initial string
+	levels  map[string]models.StickerLevelRequirement
+}
+
+type Result struct {
+	Level   string
+	Stars   int
+	LevelUp bool
+}
+
+// NewRules validates the requirement rows and builds the level chain. The chain
+// must have exactly one starting level, exactly one terminal level (empty
+// NextLevel), no cycles and no unreachable levels.
+func NewRules(reqs []models.StickerLevelRequirement) (*Rules, error) {
+	if len(reqs) == 0 {
+		return nil, ErrNoLevels
+	}
+
+	levels := make(map[string]models.StickerLevelRequirement, len(reqs))
+	for _, req := range reqs {
+		if req.Level == "" {
+			return nil, errors.New("sticker level name is empty")
+		}
+		if _, ok := levels[req.Level]; ok {
+			return nil, fmt.Errorf("sticker level %q is defined more than once", req.Level)
+		}
+		levels[req.Level] = req
+	}
+
+	referenced := make(map[string]bool, len(levels))
+	terminals := 0
+	for _, req := range levels {
+		if req.NextLevel == "" {
+			terminals++
+			continue
+		}
+		if _, ok := levels[req.NextLevel]; !ok {
+			return nil, fmt.Errorf("sticker level %q points at undefined level %q", req.Level, req.NextLevel)
+		}
+		if req.StarsRequired <= 0 {
+			return nil, fmt.Errorf("sticker level %q must require at least one star", req.Level)
+		}
+		referenced[req.NextLevel] = true
+	}
+	if terminals != 1 {
+		return nil, fmt.Errorf("expected exactly one terminal sticker level, found %d", terminals)
+	}
+
+	var roots []string
+	for level := range levels {
+		if !referenced[level] {
+			roots = append(roots, level)
+		}
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("expected exactly one starting sticker level, found %d", len(roots))
+	}
+
+	seen := make(map[string]bool, len(levels))
+	for level := roots[0]; level != ""; level = levels[level].NextLevel {
+		if seen[level] {
+			return nil, fmt.Errorf("sticker level chain has a cycle at %q", level)
+		}
+		seen[level] = true
+	}
+	if len(seen) != len(levels) {
+		return nil, errors.New("sticker level chain has a cycle or unreachable levels")
+	}
+
+	return &Rules{initial: roots[0], levels: levels}, nil
+}
+
+// Initial returns the level a new sticker starts at.
+func (r *Rules) Initial() string {
+	return r.initial
+}
+
+// Requirement returns the requirement row for the given level.
+func (r *Rules) Requirement(level string) (models.StickerLevelRequirement, bool) {
+	req, ok := r.levels[level]
+	return req, ok
+}
+
+// AddStars awards stars to a sticker currently at level with the given star
+// count. Stars beyond a level's requirement carry over into the next level.
+// Once the terminal level is reached stars keep accumulating.
+func (r *Rules) AddStars(level string, stars, add int) (Result, error) {
+	req, ok := r.levels[level]
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %q", ErrUnknownLevel, level)
+	}
+
+	res := Result{Level: level, Stars: stars + add}
+	for req.NextLevel != "" && res.Stars >= req.StarsRequired {
+		res.Stars -= req.StarsRequired
+		res.Level = req.NextLevel
+		res.LevelUp = true
+		req = r.levels[req.NextLevel]
+	}
+
+	return res, nil
+}
@@ -0,0 +1,107 @@
+package progression_test
+
+import (
+	"testing"
+
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/progression"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func defaultLevels() []models.StickerLevelRequirement {
+	return []models.StickerLevelRequirement{
+		{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+		{Level: "silver", StarsRequired: 5, NextLevel: "gold"},
+		{Level: "gold", StarsRequired: 10, NextLevel: "platinum"},
+		{Level: "platinum"},
+	}
+}
+
+func TestNewRules(t *testing.T) {
+	rules, err := progression.NewRules(defaultLevels())
+	require.NoError(t, err)
+	assert.Equal(t, "bronze", rules.Initial())
+
+	req, ok := rules.Requirement("gold")
+	assert.True(t, ok)
+	assert.Equal(t, 10, req.StarsRequired)
+}
+
+func TestNewRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		reqs []models.StickerLevelRequirement
+	}{
+		{"empty", nil},
+		{"duplicate level", []models.StickerLevelRequirement{
+			{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+			{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+			{Level: "silver"},
+		}},
+		{"undefined next level", []models.StickerLevelRequirement{
+			{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+		}},
+		{"zero stars required", []models.StickerLevelRequirement{
+			{Level: "bronze", StarsRequired: 0, NextLevel: "silver"},
+			{Level: "silver"},
+		}},
+		{"no terminal level", []models.StickerLevelRequirement{
+			{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+			{Level: "silver", StarsRequired: 5, NextLevel: "bronze"},
+		}},
+		{"two starting levels", []models.StickerLevelRequirement{
+			{Level: "bronze", StarsRequired: 5, NextLevel: "gold"},
+			{Level: "silver", StarsRequired: 5, NextLevel: "gold"},
+			{Level: "gold"},
+		}},
+		{"detached cycle", []models.StickerLevelRequirement{
+			{Level: "bronze", StarsRequired: 5, NextLevel: "platinum"},
+			{Level: "silver", StarsRequired: 5, NextLevel: "gold"},
+			{Level: "gold", StarsRequired: 5, NextLevel: "silver"},
+			{Level: "platinum"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := progression.NewRules(tt.reqs)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAddStars(t *testing.T) {
+	rules, err := progression.NewRules(defaultLevels())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		level string
+		stars int
+		add   int
+		want  progression.Result
+	}{
+		{"below threshold", "bronze", 3, 1, progression.Result{Level: "bronze", Stars: 4}},
+		{"reaches threshold", "bronze", 4, 1, progression.Result{Level: "silver", Stars: 0, LevelUp: true}},
+		{"carries over excess", "silver", 4, 3, progression.Result{Level: "gold", Stars: 2, LevelUp: true}},
+		{"skips several levels", "bronze", 0, 22, progression.Result{Level: "platinum", Stars: 2, LevelUp: true}},
+		{"terminal accumulates", "platinum", 40, 1, progression.Result{Level: "platinum", Stars: 41}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rules.AddStars(tt.level, tt.stars, tt.add)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAddStars_UnknownLevel(t *testing.T) {
+	rules, err := progression.NewRules(defaultLevels())
+	require.NoError(t, err)
+
+	_, err = rules.AddStars("diamond", 0, 1)
+	assert.ErrorIs(t, err, progression.ErrUnknownLevel)
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+var ErrInvalidAPIKey = apperr.Unauthenticated("invalid api key")
+
+const apiKeyColumns = `key_id, store_id, name, scopes, created_at, last_used_at, revoked_at`
+
+// CreateAPIKey stores the hash of a new key for a store.
+func (r *Repository) CreateAPIKey(ctx context.Context, storeID string, req models.APIKeyRequest, keyHash string) (models.APIKey, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{models.ScopePurchasesWrite}
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`INSERT INTO Store_Api_Keys (store_id, name, key_hash, scopes) VALUES ($1, $2, $3, $4)
+		RETURNING `+apiKeyColumns, storeID, req.Name, keyHash, scopes)
+	if err != nil {
+		return models.APIKey{}, mapError(err, "store not found")
+	}
+	key, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.APIKey])
+	if err != nil {
+		return models.APIKey{}, mapError(err, "store not found")
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns every key of a store, revoked ones included, oldest
+// first.
+func (r *Repository) ListAPIKeys(ctx context.Context, storeID string) (models.APIKeyListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+apiKeyColumns+` FROM Store_Api_Keys WHERE store_id = $1 ORDER BY created_at, key_id`, storeID)
+	if err != nil {
+		return models.APIKeyListResponse{}, mapError(err, "store not found")
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.APIKey])
+	if err != nil {
+		return models.APIKeyListResponse{}, mapError(err, "store not found")
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+	return models.APIKeyListResponse{APIKeys: keys}, nil
+}
+
+// RevokeAPIKey stops a store's key from authenticating. Revoking a key twice
+// keeps the original revocation time.
+func (r *Repository) RevokeAPIKey(ctx context.Context, storeID, keyID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE Store_Api_Keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+		WHERE store_id = $1 AND key_id = $2`, storeID, keyID)
+	if err != nil {
+		return mapError(err, "api key not found")
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.NotFound("api key not found")
+	}
+	return nil
+}
+
+// AuthenticateAPIKey looks up the live key with the given hash and records
+// that it was used.
+func (r *Repository) AuthenticateAPIKey(ctx context.Context, keyHash string) (models.APIKey, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`UPDATE Store_Api_Keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns, keyHash)
+	if err != nil {
+		return models.APIKey{}, mapError(err, "api key not found")
+	}
+	key, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.APIKey])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return models.APIKey{}, mapError(err, "api key not found")
+	}
+	return key, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+var ErrInvalidRefreshToken = apperr.Unauthenticated("invalid refresh token")
+
+// CreateAccount inserts a user who can log in with a password. Like
+// InsertUser it fails with a conflict when the username or email is taken.
+func (r *Repository) CreateAccount(ctx context.Context, req models.SignupRequest, passwordHash string) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.queryUser(ctx,
+		`INSERT INTO Users (username, email, password_hash) VALUES ($1, NULLIF($2, ''), $3)
+		RETURNING `+userColumns, req.Username, req.Email, passwordHash)
+}
+
+func (r *Repository) GetCredentials(ctx context.Context, username string) (models.Credentials, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var creds models.Credentials
+	err := r.pool.QueryRow(ctx,
+		`SELECT user_id, COALESCE(password_hash, '') FROM Users WHERE username = $1`, username).
+		Scan(&creds.UserID, &creds.PasswordHash)
+	if err != nil {
+		return models.Credentials{}, mapError(err, "user not found")
+	}
+	return creds, nil
+}
+
+// CreateRefreshToken stores the hash of a refresh token that stays valid for
+// ttl.
+func (r *Repository) CreateRefreshToken(ctx context.Context, userID, tokenHash string, ttl time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx, insertRefreshToken, tokenHash, userID, ttl.Seconds())
+	if err != nil {
+		return mapError(err, "user not found")
+	}
+	return nil
+}
+
+// RotateRefreshToken revokes a live refresh token and stores its replacement,
+// returning the user it belongs to. Each refresh token can be used once.
+func (r *Repository) RotateRefreshToken(ctx context.Context, oldHash, newHash string, ttl time.Duration) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var userID string
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`UPDATE Refresh_Tokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING user_id`, oldHash).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, insertRefreshToken, newHash, userID, ttl.Seconds())
+		return err
+	})
+	if err != nil {
+		return "", mapError(err, "user not found")
+	}
+	return userID, nil
+}
+
+// RevokeRefreshToken makes a refresh token unusable. Revoking an unknown or
+// already revoked token is not an error.
+func (r *Repository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx,
+		`UPDATE Refresh_Tokens SET revoked_at = CURRENT_TIMESTAMP WHERE token_hash = $1 AND revoked_at IS NULL`, tokenHash)
+	if err != nil {
+		return mapError(err, "refresh token not found")
+	}
+	return nil
+}
+
+const insertRefreshToken = `INSERT INTO Refresh_Tokens (token_hash, user_id, expires_at)
+	VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))`
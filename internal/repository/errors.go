@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+)
+
+// Postgres SQLSTATE codes the repository maps onto domain errors.
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeNotNullViolation    = "23502"
+	codeCheckViolation      = "23514"
+	codeInvalidText         = "22P02"
+	codeStringTooLong       = "22001"
+	codeSerialization       = "40001"
+	codeDeadlock            = "40P01"
+)
+
+// mapError translates pgx and Postgres errors into domain errors. notFound is
+// the client-facing message used when the query matched no rows. Errors that
+// already carry a kind are returned unchanged.
+func mapError(err error, notFound string) error {
+	if err == nil {
+		return nil
+	}
+
+	var domainErr *apperr.Error
+	if errors.As(err, &domainErr) {
+		return err
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperr.Wrap(apperr.KindNotFound, notFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == codeUniqueViolation:
+			return apperr.Wrap(apperr.KindConflict, "resource already exists", err)
+		case pgErr.Code == codeForeignKeyViolation && strings.Contains(pgErr.Detail, "is still referenced"):
+			return apperr.Wrap(apperr.KindConflict, "resource is still referenced", err)
+		case pgErr.Code == codeForeignKeyViolation:
+			return apperr.Wrap(apperr.KindNotFound, "referenced resource does not exist", err)
+		case pgErr.Code == codeInvalidText, pgErr.Code == codeCheckViolation,
+			pgErr.Code == codeNotNullViolation, pgErr.Code == codeStringTooLong:
+			return apperr.Wrap(apperr.KindValidation, "invalid input", err)
+		case pgErr.Code == codeSerialization, pgErr.Code == codeDeadlock,
+			// Class 08 connection exceptions, 53 insufficient resources,
+			// 57 operator intervention.
+			strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"), strings.HasPrefix(pgErr.Code, "57"):
+			return apperr.Wrap(apperr.KindUnavailable, "database unavailable", err)
+		}
+		return err
+	}
+
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) || errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return apperr.Wrap(apperr.KindUnavailable, "database unavailable", err)
+	}
+
+	return err
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantKind    apperr.Kind
+		wantMessage string
+	}{
+		{"no rows", pgx.ErrNoRows, apperr.KindNotFound, "user not found"},
+		{"wrapped no rows", fmt.Errorf("scan: %w", pgx.ErrNoRows), apperr.KindNotFound, "user not found"},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, apperr.KindConflict, "resource already exists"},
+		{"missing reference", &pgconn.PgError{
+			Code:   "23503",
+			Detail: `Key (store_id)=(9b2d7e41-3c5f-4a8b-8e6d-1f0a2c4b6d83) is not present in table "stores".`,
+		}, apperr.KindNotFound, "referenced resource does not exist"},
+		{"still referenced", &pgconn.PgError{
+			Code:   "23503",
+			Detail: `Key (user_id)=(4f1c2b8e-6a8d-4c0e-9d1a-2f6b7e3c9a10) is still referenced from table "purchases".`,
+		}, apperr.KindConflict, "resource is still referenced"},
+		{"invalid uuid", &pgconn.PgError{Code: "22P02"}, apperr.KindValidation, "invalid input"},
+		{"value too long", &pgconn.PgError{Code: "22001"}, apperr.KindValidation, "invalid input"},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, apperr.KindUnavailable, "database unavailable"},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, apperr.KindUnavailable, "database unavailable"},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, apperr.KindUnavailable, "database unavailable"},
+		{"deadline", context.DeadlineExceeded, apperr.KindUnavailable, "database unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapError(tt.err, "user not found")
+
+			var domainErr *apperr.Error
+			if assert.ErrorAs(t, err, &domainErr) {
+				assert.Equal(t, tt.wantKind, domainErr.Kind)
+				assert.Equal(t, tt.wantMessage, domainErr.Message)
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestMapError_PassThrough(t *testing.T) {
+	assert.NoError(t, mapError(nil, "user not found"))
+
+	domainErr := apperr.Conflict("username taken")
+	assert.Same(t, domainErr, mapError(domainErr, "user not found"))
+
+	plain := errors.New("unexpected")
+	assert.Equal(t, plain, mapError(plain, "user not found"))
+
+	syntax := &pgconn.PgError{Code: "42601"}
+	assert.Equal(t, apperr.KindInternal, apperr.KindOf(mapError(syntax, "user not found")))
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+var ErrTerminalLevel = apperr.Unprocessable("the last sticker level has no star requirement")
+
+// ListLevels returns the sticker level chain from the starting level to the
+// last one.
+func (r *Repository) ListLevels(ctx context.Context) (models.LevelListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rules, err := levelRules(ctx, r.pool)
+	if err != nil {
+		return models.LevelListResponse{}, mapError(err, "sticker level not found")
+	}
+
+	resp := models.LevelListResponse{Levels: []models.StickerLevelRequirement{}}
+	for level := rules.Initial(); level != ""; {
+		req, _ := rules.Requirement(level)
+		resp.Levels = append(resp.Levels, req)
+		level = req.NextLevel
+	}
+	return resp, nil
+}
+
+// UpdateLevel changes how many stars it takes to leave a level. Existing
+// stickers keep their level and stars until they are next awarded one or
+// replayed.
+func (r *Repository) UpdateLevel(ctx context.Context, level string, req models.LevelUpdateRequest) (models.StickerLevelRequirement, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var updated models.StickerLevelRequirement
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var terminal bool
+		err := tx.QueryRow(ctx,
+			`SELECT next_level IS NULL FROM Sticker_Level_Requirements WHERE level = $1 FOR UPDATE`, level).Scan(&terminal)
+		if err != nil {
+			return err
+		}
+		if terminal {
+			return ErrTerminalLevel
+		}
+
+		return tx.QueryRow(ctx,
+			`UPDATE Sticker_Level_Requirements SET stars_required = $2 WHERE level = $1
+			RETURNING level, stars_required, next_level`, level, req.StarsRequired).
+			Scan(&updated.Level, &updated.StarsRequired, &updated.NextLevel)
+	})
+	if err != nil {
+		return models.StickerLevelRequirement{}, mapError(err, "sticker level not found")
+	}
+	return updated, nil
+}
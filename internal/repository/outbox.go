@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+const outboxColumns = `outbox_id, event_type, user_id, store_id, payload, created_at`
+
+// ClaimOutbox picks up to limit unsent messages, oldest first, and holds them
+// for lease, so a relay that dies mid-publish has them picked up again once
+// the lease runs out. Claims are made one at a time and skip users whose
+// earlier messages another relay still holds, so every user's events are
+// published in order even with several relays running.
+func (r *Repository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var messages []models.OutboxMessage
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('outbox', 0))`); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx,
+			`UPDATE Outbox SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			WHERE outbox_id IN (
+				SELECT outbox_id FROM Outbox o
+				WHERE o.sent_at IS NULL AND (o.claimed_until IS NULL OR o.claimed_until <= CURRENT_TIMESTAMP)
+				AND NOT EXISTS (
+					SELECT 1 FROM Outbox held
+					WHERE held.user_id = o.user_id AND held.sent_at IS NULL
+					AND held.outbox_id < o.outbox_id AND held.claimed_until > CURRENT_TIMESTAMP
+				)
+				ORDER BY outbox_id LIMIT $1
+			)
+			RETURNING `+outboxColumns, limit, lease.Seconds())
+		if err != nil {
+			return err
+		}
+		messages, err = pgx.CollectRows(rows, pgx.RowToStructByPos[models.OutboxMessage])
+		return err
+	})
+	if err != nil {
+		return nil, mapError(err, "outbox message not found")
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// MarkOutboxSent records that the messages were published.
+func (r *Repository) MarkOutboxSent(ctx context.Context, ids []int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx,
+		`UPDATE Outbox SET sent_at = CURRENT_TIMESTAMP, claimed_until = NULL WHERE outbox_id = ANY($1)`, ids)
+	if err != nil {
+		return mapError(err, "outbox message not found")
+	}
+	return nil
+}
+
+// PruneOutbox deletes up to limit messages sent more than retention ago and
+// returns how many it deleted.
+func (r *Repository) PruneOutbox(ctx context.Context, retention time.Duration, limit int) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx,
+		`DELETE FROM Outbox WHERE outbox_id IN (
+			SELECT outbox_id FROM Outbox WHERE sent_at < CURRENT_TIMESTAMP - make_interval(secs => $1) LIMIT $2
+		)`, retention.Seconds(), limit)
+	if err != nil {
+		return 0, mapError(err, "outbox message not found")
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// enqueueOutbox writes a sticker event of the purchase in tx. It waits for
+// the user's earlier purchases to commit first, so their events are numbered,
+// and later published, in the order they happened.
+func enqueueOutbox(ctx context.Context, tx pgx.Tx, eventType string, event models.StickerEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, "outbox:"+event.UserID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO Outbox (event_type, user_id, store_id, payload) VALUES ($1, $2, $3, $4)`,
+		eventType, event.UserID, event.StoreID, payload)
+	return err
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/m-garey/fetchit-backend/internal/logging"
+	"github.com/m-garey/fetchit-backend/internal/tracing"
+)
+
+// PoolConfig builds the pgxpool configuration for the given database settings.
+// Queries are traced as children of the span in their context and logged at
+// debug level.
+func PoolConfig(cfg config.Database) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	poolCfg.MaxConns = cfg.MaxConns
+	poolCfg.MinConns = cfg.MinConns
+	poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	poolCfg.ConnConfig.Tracer = multitracer.New(tracing.NewQueryTracer(), logging.NewQueryLogger())
+
+	return poolCfg, nil
+}
+
+// NewPool opens a connection pool and verifies it can reach the database.
+func NewPool(ctx context.Context, cfg config.Database) (*pgxpool.Pool, error) {
+	poolCfg, err := PoolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+)
+
+func (r *Repository) ListPurchasesByUser(ctx context.Context, userID string, filter models.PurchaseFilter) (models.PurchaseListResponse, error) {
+	return r.listPurchases(ctx, "user_id", userID, filter)
+}
+
+func (r *Repository) ListPurchasesByStore(ctx context.Context, storeID string, filter models.PurchaseFilter) (models.PurchaseListResponse, error) {
+	return r.listPurchases(ctx, "store_id", storeID, filter)
+}
+
+// listPurchases pages through the ledger newest first. column is always one of
+// the constants passed by the exported wrappers, never user input.
+func (r *Repository) listPurchases(ctx context.Context, column, id string, filter models.PurchaseFilter) (models.PurchaseListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT purchase_id, user_id, store_id, purchase_time, source FROM Purchases WHERE ` + column + ` = $1`
+	args := []any{id}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(` AND purchase_time >= $%d`, len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(` AND purchase_time < $%d`, len(args))
+	}
+	if after := filter.Page.After; after != nil {
+		t, err := time.Parse(time.RFC3339Nano, after.Value)
+		if err != nil {
+			return models.PurchaseListResponse{}, pagination.ErrInvalidCursor
+		}
+		args = append(args, t, after.ID)
+		query += fmt.Sprintf(` AND (purchase_time, purchase_id) < ($%d, $%d::uuid)`, len(args)-1, len(args))
+	}
+
+	args = append(args, filter.Page.Limit+1)
+	query += fmt.Sprintf(` ORDER BY purchase_time DESC, purchase_id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return models.PurchaseListResponse{}, mapError(err, "purchase not found")
+	}
+	purchases, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Purchase])
+	if err != nil {
+		return models.PurchaseListResponse{}, mapError(err, "purchase not found")
+	}
+
+	resp := models.PurchaseListResponse{Purchases: purchases}
+	if len(purchases) > filter.Page.Limit {
+		resp.Purchases = purchases[:filter.Page.Limit]
+		last := resp.Purchases[len(resp.Purchases)-1]
+		resp.NextCursor = pagination.Encode(pagination.Cursor{
+			Value: last.PurchaseTime.Format(time.RFC3339Nano),
+			ID:    last.ID,
+		})
+	}
+	if resp.Purchases == nil {
+		resp.Purchases = []models.Purchase{}
+	}
+
+	return resp, nil
+}
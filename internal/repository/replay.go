@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/progression"
+)
+
+type stickerKey struct {
+	userID  string
+	storeID string
+}
+
+// ReplayProgress recomputes User_Sticker_Progress from the Purchases ledger
+// using the current level rules. Unless the request is a dry run the
+// differences are written back while the progress table is locked against
+// concurrent purchases. Stickers without ledger history are reported but kept
+// unless the request asks to delete them, and only count as changed then.
+// Replays can touch every sticker, so they are not bounded by the per-query
+// timeout.
+func (r *Repository) ReplayProgress(ctx context.Context, req models.ReplayRequest) (models.ReplayReport, error) {
+	var report models.ReplayReport
+
+	txOptions := pgx.TxOptions{}
+	if req.DryRun {
+		txOptions.AccessMode = pgx.ReadOnly
+	}
+
+	err := pgx.BeginTxFunc(ctx, r.pool, txOptions, func(tx pgx.Tx) error {
+		if !req.DryRun {
+			if _, err := tx.Exec(ctx, `LOCK TABLE User_Sticker_Progress IN EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+		}
+
+		rules, err := levelRules(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		userID, storeID := nullable(req.UserID), nullable(req.StoreID)
+
+		rows, err := tx.Query(ctx,
+			`SELECT user_id, store_id, COUNT(*) FROM Purchases
+			WHERE ($1::uuid IS NULL OR user_id = $1) AND ($2::uuid IS NULL OR store_id = $2)
+			GROUP BY user_id, store_id`, userID, storeID)
+		if err != nil {
+			return err
+		}
+		counts := map[stickerKey]int{}
+		var key stickerKey
+		var count int
+		_, err = pgx.ForEachRow(rows, []any{&key.userID, &key.storeID, &count}, func() error {
+			counts[key] = count
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(ctx,
+			`SELECT user_id, store_id, current_level, star_count FROM User_Sticker_Progress
+			WHERE ($1::uuid IS NULL OR user_id = $1) AND ($2::uuid IS NULL OR store_id = $2)`, userID, storeID)
+		if err != nil {
+			return err
+		}
+		current := map[stickerKey]models.StickerState{}
+		var state models.StickerState
+		_, err = pgx.ForEachRow(rows, []any{&key.userID, &key.storeID, &state.Level, &state.StarCount}, func() error {
+			current[key] = state
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		diffs, err := diffProgress(rules, counts, current)
+		if err != nil {
+			return err
+		}
+
+		changed := 0
+		for _, d := range diffs {
+			if !d.NoLedgerHistory || req.DeleteWithoutHistory {
+				changed++
+			}
+		}
+		report = models.ReplayReport{
+			DryRun:  req.DryRun,
+			Scanned: len(union(counts, current)),
+			Changed: changed,
+			Diffs:   diffs,
+		}
+		if req.DryRun {
+			return nil
+		}
+
+		for _, d := range diffs {
+			switch {
+			case d.NoLedgerHistory && !req.DeleteWithoutHistory:
+				continue
+			case d.After == nil:
+				_, err = tx.Exec(ctx,
+					`DELETE FROM User_Sticker_Progress WHERE user_id = $1 AND store_id = $2`, d.UserID, d.StoreID)
+			case d.Before == nil:
+				_, err = tx.Exec(ctx,
+					`INSERT INTO User_Sticker_Progress (user_id, store_id, current_level, star_count) VALUES ($1, $2, $3, $4)`,
+					d.UserID, d.StoreID, d.After.Level, d.After.StarCount)
+			default:
+				_, err = tx.Exec(ctx,
+					`UPDATE User_Sticker_Progress SET current_level=$1, star_count=$2, last_updated=CURRENT_TIMESTAMP
+					WHERE user_id=$3 AND store_id=$4`, d.After.Level, d.After.StarCount, d.UserID, d.StoreID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.ReplayReport{}, mapError(err, "sticker not found")
+	}
+
+	return report, nil
+}
+
+// diffProgress compares stored progress with the progress the ledger's
+// purchase counts earn under rules, ordered by user and store.
+func diffProgress(rules *progression.Rules, counts map[stickerKey]int, current map[stickerKey]models.StickerState) ([]models.StickerDiff, error) {
+	diffs := []models.StickerDiff{}
+
+	for key := range union(counts, current) {
+		d := models.StickerDiff{UserID: key.userID, StoreID: key.storeID}
+
+		if state, ok := current[key]; ok {
+			d.Before = &state
+		}
+		if n, ok := counts[key]; ok {
+			res, err := rules.AddStars(rules.Initial(), 0, n)
+			if err != nil {
+				return nil, err
+			}
+			d.After = &models.StickerState{Level: res.Level, StarCount: res.Stars}
+		} else {
+			d.NoLedgerHistory = true
+		}
+
+		if d.Before != nil && d.After != nil && *d.Before == *d.After {
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].UserID != diffs[j].UserID {
+			return diffs[i].UserID < diffs[j].UserID
+		}
+		return diffs[i].StoreID < diffs[j].StoreID
+	})
+
+	return diffs, nil
+}
+
+func union(counts map[stickerKey]int, current map[stickerKey]models.StickerState) map[stickerKey]struct{} {
+	keys := make(map[stickerKey]struct{}, len(current))
+	for k := range counts {
+		keys[k] = struct{}{}
+	}
+	for k := range current {
+		keys[k] = struct{}{}
+	}
+	return keys
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/progression"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffProgress(t *testing.T) {
+	rules, err := progression.NewRules([]models.StickerLevelRequirement{
+		{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+		{Level: "silver", StarsRequired: 5, NextLevel: "gold"},
+		{Level: "gold"},
+	})
+	require.NoError(t, err)
+
+	matching := stickerKey{"u1", "s1"}
+	drifted := stickerKey{"u1", "s2"}
+	missing := stickerKey{"u2", "s1"}
+	orphaned := stickerKey{"u3", "s1"}
+
+	counts := map[stickerKey]int{
+		matching: 3,
+		drifted:  7,
+		missing:  12,
+	}
+	current := map[stickerKey]models.StickerState{
+		matching: {Level: "bronze", StarCount: 3},
+		drifted:  {Level: "bronze", StarCount: 7},
+		orphaned: {Level: "silver", StarCount: 1},
+	}
+
+	diffs, err := diffProgress(rules, counts, current)
+	require.NoError(t, err)
+
+	assert.Equal(t, []models.StickerDiff{
+		{
+			UserID:  "u1",
+			StoreID: "s2",
+			Before:  &models.StickerState{Level: "bronze", StarCount: 7},
+			After:   &models.StickerState{Level: "silver", StarCount: 2},
+		},
+		{
+			UserID:  "u2",
+			StoreID: "s1",
+			After:   &models.StickerState{Level: "gold", StarCount: 2},
+		},
+		{
+			UserID:          "u3",
+			StoreID:         "s1",
+			Before:          &models.StickerState{Level: "silver", StarCount: 1},
+			NoLedgerHistory: true,
+		},
+	}, diffs)
+}
+
+func TestDiffProgress_NothingToDo(t *testing.T) {
+	rules, err := progression.NewRules([]models.StickerLevelRequirement{
+		{Level: "bronze", StarsRequired: 5, NextLevel: "silver"},
+		{Level: "silver"},
+	})
+	require.NoError(t, err)
+
+	diffs, err := diffProgress(rules, map[stickerKey]int{}, map[stickerKey]models.StickerState{})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
@@ -2,197 +2,338 @@ package repository
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
 	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/progression"
+)
+
+var (
+	ErrIdempotencyKeyReused = apperr.Unprocessable("idempotency key was already used for a different request")
+	ErrStoreInactive        = apperr.Unprocessable("store is inactive and does not accept purchases")
 )
 
 type Repository struct {
-	conn *pgx.Conn
+	pool           *pgxpool.Pool
+	queryTimeout   time.Duration
+	idempotencyTTL time.Duration
 }
 
 type API interface {
-	CreateTables() error
-	InsertUser(models.UserRequest) (models.UserResponse, error)
-	InsertStore(models.StoreRequest) (models.StoreResponse, error)
-	UpsertStar(models.PurchaseRequest) (models.PurchaseResponse, error)
-	GetSticker(string, string) (models.UserStickerResponse, error)
-	GetStickersByUser(string) (models.StickerByUserResponse, error)
+	InsertUser(context.Context, models.UserRequest) (models.UserResponse, error)
+	GetUser(context.Context, string) (models.User, error)
+	UpdateUser(context.Context, string, models.UserUpdateRequest) (models.User, error)
+	DeleteUser(context.Context, string) error
+	ListUsers(context.Context, models.UserFilter) (models.UserListResponse, error)
+	UpdateEmail(context.Context, string, string) (models.User, error)
+	VerifyEmail(context.Context, string, string) (models.User, error)
+	CreateAccount(context.Context, models.SignupRequest, string) (models.User, error)
+	GetCredentials(context.Context, string) (models.Credentials, error)
+	CreateRefreshToken(context.Context, string, string, time.Duration) error
+	RotateRefreshToken(context.Context, string, string, time.Duration) (string, error)
+	RevokeRefreshToken(context.Context, string) error
+	InsertStore(context.Context, models.StoreRequest) (models.StoreResponse, error)
+	GetStore(context.Context, string) (models.Store, error)
+	UpdateStore(context.Context, string, models.StoreUpdateRequest) (models.Store, error)
+	SetStoreActive(context.Context, string, bool) (models.Store, error)
+	ListStores(context.Context, models.StoreFilter) (models.StoreListResponse, error)
+	GetStoreStats(context.Context, string) (models.StoreStats, error)
+	ListRoles(context.Context, string) (models.Roles, error)
+	AssignRole(context.Context, string, models.RoleRequest) (models.RoleAssignment, error)
+	RevokeRole(context.Context, string, string) error
+	ListLevels(context.Context) (models.LevelListResponse, error)
+	UpdateLevel(context.Context, string, models.LevelUpdateRequest) (models.StickerLevelRequirement, error)
+	CreateAPIKey(context.Context, string, models.APIKeyRequest, string) (models.APIKey, error)
+	ListAPIKeys(context.Context, string) (models.APIKeyListResponse, error)
+	RevokeAPIKey(context.Context, string, string) error
+	AuthenticateAPIKey(context.Context, string) (models.APIKey, error)
+	CreateWebhook(context.Context, string, models.WebhookRequest, string) (models.Webhook, error)
+	ListWebhooks(context.Context, string) (models.WebhookListResponse, error)
+	DeleteWebhook(context.Context, string, string) error
+	ListWebhookDeliveries(context.Context, string, string, models.WebhookDeliveryFilter) (models.WebhookDeliveryListResponse, error)
+	ClaimWebhookDeliveries(context.Context, int, time.Duration) ([]models.DueWebhookDelivery, error)
+	RecordWebhookAttempt(context.Context, string, models.WebhookAttempt) error
+	EnqueueWebhooks(context.Context, models.OutboxMessage) error
+	ClaimOutbox(context.Context, int, time.Duration) ([]models.OutboxMessage, error)
+	MarkOutboxSent(context.Context, []int64) error
+	PruneOutbox(context.Context, time.Duration, int) (int, error)
+	UpsertStar(context.Context, models.PurchaseRequest) (models.PurchaseResponse, error)
+	UpsertStarOnce(context.Context, models.PurchaseRequest, models.IdempotencyKey) (models.IdempotentPurchaseResponse, error)
+	GetSticker(context.Context, string, string) (models.UserStickerResponse, error)
+	GetStickersByUser(context.Context, string, models.StickerFilter) (models.StickerByUserResponse, error)
+	ListPurchasesByUser(context.Context, string, models.PurchaseFilter) (models.PurchaseListResponse, error)
+	ListPurchasesByStore(context.Context, string, models.PurchaseFilter) (models.PurchaseListResponse, error)
+	ReplayProgress(context.Context, models.ReplayRequest) (models.ReplayReport, error)
 }
 
-func New(db *pgx.Conn) *Repository {
-	return &Repository{conn: db}
+// querier is satisfied by both the pool and a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
 }
 
-func (r *Repository) CreateTables() error {
-	schema := `
-	CREATE TABLE Users (
-	user_id UUID PRIMARY KEY,
-	username VARCHAR(50) NOT NULL,
-	email VARCHAR(100),
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE Stores (
-	store_id UUID PRIMARY KEY,
-	store_name VARCHAR(100) NOT NULL,
-	location VARCHAR(255),
-	sticker_theme VARCHAR(100),
-	is_active BOOLEAN DEFAULT TRUE
-	);
-
-	CREATE TABLE User_Sticker_Progress (
-	user_sticker_id UUID PRIMARY KEY,
-	user_id UUID REFERENCES Users(user_id),
-	store_id UUID REFERENCES Stores(store_id),
-	current_level VARCHAR(20) CHECK (current_level IN ('bronze', 'silver', 'gold', 'platinum')),
-	star_count INT DEFAULT 0,
-	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE Purchases (
-	purchase_id UUID PRIMARY KEY,
-	user_id UUID REFERENCES Users(user_id),
-	store_id UUID REFERENCES Stores(store_id),
-	purchase_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-	source VARCHAR(50)
-	);
-
-	CREATE TABLE Sticker_Level_Requirements (
-	level VARCHAR(20) PRIMARY KEY,
-	stars_required INT,
-	next_level VARCHAR(20)
-	);
-	`
-	_, err := r.conn.Exec(context.Background(), schema)
-	if err != nil {
-		return err
+type Option func(*Repository)
+
+// WithQueryTimeout bounds every repository call. A zero timeout leaves the
+// caller's context untouched.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(r *Repository) {
+		r.queryTimeout = d
 	}
-	return nil
 }
 
-func (r *Repository) InsertUser(user models.UserRequest) (models.UserResponse, error) {
-	var id string
-	err := r.conn.QueryRow(context.Background(),
-		`INSERT INTO users (username) VALUES ($1) ON CONFLICT (username) DO UPDATE SET username=EXCLUDED.username RETURNING id`, user.Username).Scan(&id)
+// WithIdempotencyTTL sets how long an idempotency key replays its original
+// response.
+func WithIdempotencyTTL(d time.Duration) Option {
+	return func(r *Repository) {
+		r.idempotencyTTL = d
+	}
+}
+
+func New(pool *pgxpool.Pool, opts ...Option) *Repository {
+	r := &Repository{pool: pool, idempotencyTTL: 24 * time.Hour}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.queryTimeout)
+}
+
+// InsertUser creates a user without a password. A taken username or email is a
+// conflict.
+func (r *Repository) InsertUser(ctx context.Context, user models.UserRequest) (models.UserResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var resp models.UserResponse
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO Users (username, email) VALUES ($1, NULLIF($2, '')) RETURNING user_id, COALESCE(email, '')`,
+		user.Username, user.Email).Scan(&resp.ID, &resp.Email)
 	if err != nil {
-		return models.UserResponse{}, err
+		return models.UserResponse{}, mapError(err, "user not found")
 	}
-	return models.UserResponse{
-		ID: id,
-	}, nil
+	return resp, nil
 }
 
-func (r *Repository) InsertStore(store models.StoreRequest) (models.StoreResponse, error) {
+func (r *Repository) InsertStore(ctx context.Context, store models.StoreRequest) (models.StoreResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var id string
-	err := r.conn.QueryRow(context.Background(),
-		`INSERT INTO stores (name, location) VALUES ($1, $2) RETURNING id`, store.Name, store.Location).Scan(&id)
+	err := r.pool.QueryRow(ctx,
+		`INSERT INTO Stores (store_name, location, sticker_theme) VALUES ($1, $2, NULLIF($3, '')) RETURNING store_id`,
+		store.Name, store.Location, store.StickerTheme).Scan(&id)
 	if err != nil {
-		return models.StoreResponse{}, err
+		return models.StoreResponse{}, mapError(err, "store not found")
 	}
 	return models.StoreResponse{
 		ID: id,
 	}, nil
 }
 
-func (r *Repository) UpsertStar(purchase models.PurchaseRequest) (models.PurchaseResponse, error) {
-	var stars int
-	var level string
-	var level_up bool
-
-	// Insert sticker if not exists
-	_, _ = r.conn.Exec(context.Background(),
-		`INSERT INTO User_Sticker_Progress (user_id, store_id) VALUES ($1, $2)
-		ON CONFLICT DO NOTHING`, purchase.UserID, purchase.StoreID)
+// UpsertStar records the purchase and awards its star in a single transaction.
+// The progress row is created or locked by one upsert, so concurrent purchases
+// for the same user and store are applied one after another.
+func (r *Repository) UpsertStar(ctx context.Context, purchase models.PurchaseRequest) (models.PurchaseResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 
-	err := r.conn.QueryRow(context.Background(),
-		`SELECT stars, level FROM stickers WHERE user_id=$1 AND store_id=$2`, purchase.UserID, purchase.StoreID).Scan(&stars, &level)
-	if err != nil {
-		return models.PurchaseResponse{}, err
-	}
-
-	stars++
-	newLevel := level
-	switch {
-	case level == "bronze" && stars >= 5:
-		level_up = true
-		newLevel = "silver"
-		stars = 0
-	case level == "silver" && stars >= 5:
-		level_up = true
-		newLevel = "gold"
-		stars = 0
-	default:
-		level_up = false
-	}
-
-	_, err = r.conn.Exec(context.Background(),
-		`UPDATE User_Sticker_Progress SET stars=$1, level=$2 WHERE user_id=$3 AND store_id=$4`, stars, newLevel, purchase.UserID, purchase.StoreID)
+	var resp models.PurchaseResponse
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var err error
+		resp, _, err = upsertStar(ctx, tx, purchase)
+		return err
+	})
 	if err != nil {
-		return models.PurchaseResponse{}, err
+		return models.PurchaseResponse{}, mapError(err, "sticker not found")
 	}
 
-	return models.PurchaseResponse{
-		LevelUp:   level_up,
-		Level:     newLevel,
-		StarCount: stars,
-	}, nil
+	return resp, nil
 }
 
-func (r *Repository) GetSticker(userID string, storeID string) (models.UserStickerResponse, error) {
-	var stars int
-	var level string
-	var location string
-	var storeName string
-
-	err := r.conn.QueryRow(context.Background(),
-		`SELECT st.store_name, st.location, usp.star_count, usp.current_level
-		 FROM User_Sticker_Progress usp
-		 JOIN Stores st ON usp.store_id = st.store_id
-		 WHERE usp.user_id = $1 AND usp.store_id = $2`, userID, storeID).Scan(&storeName, &location, &stars, &level)
+// UpsertStarOnce is UpsertStar guarded by an idempotency key. A key seen within
+// the retention window replays the stored response body instead of awarding
+// another star; reusing it for a different request returns
+// ErrIdempotencyKeyReused.
+func (r *Repository) UpsertStarOnce(ctx context.Context, purchase models.PurchaseRequest, key models.IdempotencyKey) (models.IdempotentPurchaseResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var resp models.IdempotentPurchaseResponse
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		// Serialize requests that share a key until this transaction ends.
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1 || ':' || $2, 0))`, key.Scope, key.Key); err != nil {
+			return err
+		}
+
+		var hash string
+		var body []byte
+		err := tx.QueryRow(ctx,
+			`SELECT request_hash, response_body FROM Purchase_Idempotency_Keys
+			WHERE scope = $1 AND idempotency_key = $2 AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $3)`,
+			key.Scope, key.Key, r.idempotencyTTL.Seconds()).Scan(&hash, &body)
+		switch {
+		case err == nil:
+			if hash != key.RequestHash {
+				return ErrIdempotencyKeyReused
+			}
+			resp = models.IdempotentPurchaseResponse{Body: body, Replayed: true}
+			return nil
+		case !errors.Is(err, pgx.ErrNoRows):
+			return err
+		}
+
+		purchaseResp, purchaseID, err := upsertStar(ctx, tx, purchase)
+		if err != nil {
+			return err
+		}
+		body, err = json.Marshal(purchaseResp)
+		if err != nil {
+			return err
+		}
+
+		// An expired key is overwritten rather than replayed.
+		_, err = tx.Exec(ctx,
+			`INSERT INTO Purchase_Idempotency_Keys (scope, idempotency_key, request_hash, response_body, purchase_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (scope, idempotency_key) DO UPDATE SET request_hash=EXCLUDED.request_hash,
+			response_body=EXCLUDED.response_body, purchase_id=EXCLUDED.purchase_id, created_at=CURRENT_TIMESTAMP`,
+			key.Scope, key.Key, key.RequestHash, body, purchaseID)
+		if err != nil {
+			return err
+		}
+
+		resp = models.IdempotentPurchaseResponse{Body: body}
+		return nil
+	})
 	if err != nil {
-		return models.UserStickerResponse{}, err
+		return models.IdempotentPurchaseResponse{}, mapError(err, "sticker not found")
 	}
 
-	return models.UserStickerResponse{
-		StoreName: storeName,
-		Location:  location,
-		StarCount: stars,
-		Level:     level,
-	}, nil
+	return resp, nil
 }
 
-func (r *Repository) GetStickersByUser(userID string) (models.StickerByUserResponse, error) {
-	var resp models.StickerByUserResponse
+func upsertStar(ctx context.Context, tx pgx.Tx, purchase models.PurchaseRequest) (models.PurchaseResponse, string, error) {
+	rules, err := levelRules(ctx, tx)
+	if err != nil {
+		return models.PurchaseResponse{}, "", err
+	}
 
-	rows, err := r.conn.Query(context.Background(),
-		`SELECT s.id, st.name, st.location, s.stars, s.level FROM User_Sticker_Progress s
-		JOIN stores st ON s.store_id = st.id WHERE s.user_id = $1`, userID)
+	// FOR SHARE keeps the store from being deactivated until this purchase
+	// commits.
+	var active bool
+	err = tx.QueryRow(ctx,
+		`SELECT is_active FROM Stores WHERE store_id = $1 FOR SHARE`, purchase.StoreID).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.PurchaseResponse{}, "", apperr.NotFound("store not found")
+	}
 	if err != nil {
-		return models.StickerByUserResponse{}, err
+		return models.PurchaseResponse{}, "", err
+	}
+	if !active {
+		return models.PurchaseResponse{}, "", ErrStoreInactive
 	}
 
-	for rows.Next() {
-		var id int
-		var storeName, location, level string
-		var stars int
+	source := purchase.Source
+	if source == "" {
+		source = models.PurchaseSourceApp
+	}
 
-		err := rows.Scan(&id, &storeName, &location, &stars, &level)
-		if err != nil {
-			return models.StickerByUserResponse{}, err
-		}
-		sticker := models.UserStickerResponse{
-			StoreName: storeName,
-			Location:  location,
-			StarCount: stars,
-			Level:     level,
+	var purchaseID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO Purchases (user_id, store_id, source) VALUES ($1, $2, $3) RETURNING purchase_id`,
+		purchase.UserID, purchase.StoreID, source).Scan(&purchaseID)
+	if err != nil {
+		return models.PurchaseResponse{}, "", err
+	}
+
+	// xmax is only zero on a freshly inserted row.
+	var stars int
+	var level string
+	var created bool
+	err = tx.QueryRow(ctx,
+		`INSERT INTO User_Sticker_Progress (user_id, store_id, current_level) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, store_id) DO UPDATE SET last_updated=CURRENT_TIMESTAMP
+		RETURNING star_count, current_level, xmax = 0`, purchase.UserID, purchase.StoreID, rules.Initial()).Scan(&stars, &level, &created)
+	if err != nil {
+		return models.PurchaseResponse{}, "", err
+	}
+
+	res, err := rules.AddStars(level, stars, 1)
+	if err != nil {
+		return models.PurchaseResponse{}, "", err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE User_Sticker_Progress SET star_count=$1, current_level=$2, last_updated=CURRENT_TIMESTAMP WHERE user_id=$3 AND store_id=$4`, res.Stars, res.Level, purchase.UserID, purchase.StoreID)
+	if err != nil {
+		return models.PurchaseResponse{}, "", err
+	}
+
+	event := models.StickerEvent{UserID: purchase.UserID, StoreID: purchase.StoreID, Level: res.Level, StarCount: res.Stars}
+	if err := enqueueOutbox(ctx, tx, models.EventStarAwarded, event); err != nil {
+		return models.PurchaseResponse{}, "", err
+	}
+	if res.LevelUp {
+		if err := enqueueOutbox(ctx, tx, models.EventLevelUp, event); err != nil {
+			return models.PurchaseResponse{}, "", err
 		}
+	}
 
-		resp.Stickers = append(resp.Stickers, sticker)
+	return models.PurchaseResponse{
+		LevelUp:    res.LevelUp,
+		Level:      res.Level,
+		StarCount:  res.Stars,
+		NewSticker: created,
+	}, purchaseID, nil
+}
 
-		fmt.Printf("Sticker %d - %s (%s): %d stars, Level: %s\n", id, storeName, location, stars, level)
+// levelRules loads the level chain on every call so threshold changes in
+// Sticker_Level_Requirements take effect without a redeploy.
+func levelRules(ctx context.Context, q querier) (*progression.Rules, error) {
+	rows, err := q.Query(ctx,
+		`SELECT level, COALESCE(stars_required, 0), COALESCE(next_level, '') FROM Sticker_Level_Requirements`)
+	if err != nil {
+		return nil, err
 	}
 
-	return resp, nil
+	reqs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.StickerLevelRequirement, error) {
+		var req models.StickerLevelRequirement
+		err := row.Scan(&req.Level, &req.StarsRequired, &req.NextLevel)
+		return req, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return progression.NewRules(reqs)
+}
+
+func (r *Repository) GetSticker(ctx context.Context, userID string, storeID string) (models.UserStickerResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+stickerColumns+stickerFrom+` WHERE s.user_id = $1 AND s.store_id = $2`, userID, storeID)
+	if err != nil {
+		return models.UserStickerResponse{}, mapError(err, "sticker not found")
+	}
+	sticker, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.UserStickerResponse])
+	if err != nil {
+		return models.UserStickerResponse{}, mapError(err, "sticker not found")
+	}
+	return sticker, nil
 }
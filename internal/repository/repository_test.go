@@ -0,0 +1,819 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/m-garey/fetchit-backend/internal/migrate"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/outbox"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+	"github.com/m-garey/fetchit-backend/internal/progression"
+	"github.com/m-garey/fetchit-backend/internal/repository"
+	"github.com/m-garey/fetchit-backend/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRepository connects to TEST_DATABASE_URL, migrates it and returns a
+// repository on a fresh pool. Tests are skipped when the variable is unset.
+func newTestRepository(t *testing.T) (*repository.Repository, *pgxpool.Pool) {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, url)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	m, err := migrate.New(conn)
+	require.NoError(t, err)
+	_, err = m.Up(ctx)
+	require.NoError(t, err)
+
+	pool, err := repository.NewPool(ctx, config.Database{URL: url, MaxConns: 20})
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	return repository.New(pool), pool
+}
+
+func createUserAndStore(t *testing.T, pool *pgxpool.Pool) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	var userID, storeID string
+	require.NoError(t, pool.QueryRow(ctx,
+		`INSERT INTO Users (username) VALUES ('concurrency-' || gen_random_uuid()) RETURNING user_id`).Scan(&userID))
+	require.NoError(t, pool.QueryRow(ctx,
+		`INSERT INTO Stores (store_name) VALUES ('Concurrency Store') RETURNING store_id`).Scan(&storeID))
+
+	return userID, storeID
+}
+
+func TestUpsertStar_ConcurrentPurchases(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	const purchases = 40
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	levelUps, created := 0, 0
+	errs := make(chan error, purchases)
+
+	for i := 0; i < purchases; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+			if err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			if resp.LevelUp {
+				levelUps++
+			}
+			if resp.NewSticker {
+				created++
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	var recorded int
+	require.NoError(t, pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM Purchases WHERE user_id = $1 AND store_id = $2`, userID, storeID).Scan(&recorded))
+	assert.Equal(t, purchases, recorded)
+
+	var level string
+	var stars int
+	require.NoError(t, pool.QueryRow(ctx,
+		`SELECT current_level, star_count FROM User_Sticker_Progress WHERE user_id = $1 AND store_id = $2`,
+		userID, storeID).Scan(&level, &stars))
+
+	// Replay the same purchases one at a time against the level rules to get
+	// the expected state and number of level-ups.
+	rows, err := pool.Query(ctx,
+		`SELECT level, COALESCE(stars_required, 0), COALESCE(next_level, '') FROM Sticker_Level_Requirements`)
+	require.NoError(t, err)
+	reqs, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.StickerLevelRequirement])
+	require.NoError(t, err)
+	rules, err := progression.NewRules(reqs)
+	require.NoError(t, err)
+
+	want := progression.Result{Level: rules.Initial()}
+	wantLevelUps := 0
+	for i := 0; i < purchases; i++ {
+		want, err = rules.AddStars(want.Level, want.Stars, 1)
+		require.NoError(t, err)
+		if want.LevelUp {
+			wantLevelUps++
+		}
+	}
+
+	assert.Equal(t, want.Level, level)
+	assert.Equal(t, want.Stars, stars, "every purchase must award exactly one star")
+	assert.Equal(t, wantLevelUps, levelUps, "every level must be reached exactly once")
+	assert.Equal(t, 1, created, "only the first purchase creates the sticker")
+}
+
+func TestUpsertStarOnce_ReplaysWithinWindow(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	req := models.PurchaseRequest{UserID: userID, StoreID: storeID}
+	key := models.IdempotencyKey{Scope: "user:" + userID, Key: "replay-" + userID, RequestHash: strings.Repeat("a", 64)}
+
+	first, err := repo.UpsertStarOnce(ctx, req, key)
+	require.NoError(t, err)
+	assert.False(t, first.Replayed)
+
+	second, err := repo.UpsertStarOnce(ctx, req, key)
+	require.NoError(t, err)
+	assert.True(t, second.Replayed)
+	assert.Equal(t, first.Body, second.Body)
+
+	var recorded int
+	require.NoError(t, pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM Purchases WHERE user_id = $1`, userID).Scan(&recorded))
+	assert.Equal(t, 1, recorded)
+
+	key.RequestHash = strings.Repeat("b", 64)
+	_, err = repo.UpsertStarOnce(ctx, req, key)
+	assert.ErrorIs(t, err, repository.ErrIdempotencyKeyReused)
+
+	// Another caller that picked the same key gets a purchase of its own.
+	other := models.IdempotencyKey{Scope: "api_key:terminal", Key: key.Key, RequestHash: strings.Repeat("b", 64)}
+	third, err := repo.UpsertStarOnce(ctx, req, other)
+	require.NoError(t, err)
+	assert.False(t, third.Replayed)
+	require.NoError(t, pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM Purchases WHERE user_id = $1`, userID).Scan(&recorded))
+	assert.Equal(t, 2, recorded)
+}
+
+func TestListPurchasesByUser_Pages(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	for _, source := range []string{"app", "pos", ""} {
+		_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID, Source: source})
+		require.NoError(t, err)
+	}
+
+	first, err := repo.ListPurchasesByUser(ctx, userID, models.PurchaseFilter{Page: pagination.Page{Limit: 2}})
+	require.NoError(t, err)
+	require.Len(t, first.Purchases, 2)
+	require.NotEmpty(t, first.NextCursor)
+
+	after, err := pagination.Decode(first.NextCursor)
+	require.NoError(t, err)
+	second, err := repo.ListPurchasesByUser(ctx, userID, models.PurchaseFilter{Page: pagination.Page{Limit: 2, After: &after}})
+	require.NoError(t, err)
+	require.Len(t, second.Purchases, 1)
+	assert.Empty(t, second.NextCursor)
+
+	sources := map[string]int{}
+	for _, p := range append(first.Purchases, second.Purchases...) {
+		sources[p.Source]++
+	}
+	assert.Equal(t, map[string]int{"app": 2, "pos": 1}, sources)
+}
+
+func TestReplayProgress_RepairsDrift(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+		require.NoError(t, err)
+	}
+	_, err := pool.Exec(ctx,
+		`UPDATE User_Sticker_Progress SET star_count = 42 WHERE user_id = $1 AND store_id = $2`, userID, storeID)
+	require.NoError(t, err)
+
+	dry, err := repo.ReplayProgress(ctx, models.ReplayRequest{UserID: userID, DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, dry.Diffs, 1)
+	assert.Equal(t, 42, dry.Diffs[0].Before.StarCount)
+	assert.Equal(t, 3, dry.Diffs[0].After.StarCount)
+
+	var stars int
+	require.NoError(t, pool.QueryRow(ctx,
+		`SELECT star_count FROM User_Sticker_Progress WHERE user_id = $1`, userID).Scan(&stars))
+	assert.Equal(t, 42, stars, "dry run must not write")
+
+	applied, err := repo.ReplayProgress(ctx, models.ReplayRequest{UserID: userID})
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied.Changed)
+
+	require.NoError(t, pool.QueryRow(ctx,
+		`SELECT star_count FROM User_Sticker_Progress WHERE user_id = $1`, userID).Scan(&stars))
+	assert.Equal(t, 3, stars)
+}
+
+func TestReplayProgress_KeepsStickersWithoutLedgerHistory(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	// Progress earned before the ledger existed has no purchases behind it.
+	_, err := pool.Exec(ctx,
+		`INSERT INTO User_Sticker_Progress (user_id, store_id, current_level, star_count) VALUES ($1, $2, 'silver', 4)`,
+		userID, storeID)
+	require.NoError(t, err)
+
+	report, err := repo.ReplayProgress(ctx, models.ReplayRequest{UserID: userID})
+	require.NoError(t, err)
+	require.Len(t, report.Diffs, 1)
+	assert.True(t, report.Diffs[0].NoLedgerHistory)
+	assert.Nil(t, report.Diffs[0].After)
+	assert.Zero(t, report.Changed)
+
+	sticker, err := repo.GetSticker(ctx, userID, storeID)
+	require.NoError(t, err, "replay must not delete progress it cannot rebuild")
+	assert.Equal(t, "silver", sticker.Level)
+	assert.Equal(t, 4, sticker.StarCount)
+
+	report, err = repo.ReplayProgress(ctx, models.ReplayRequest{UserID: userID, DeleteWithoutHistory: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Changed)
+	_, err = repo.GetSticker(ctx, userID, storeID)
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(err))
+}
+
+func TestUserLifecycle(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.NoError(t, err)
+
+	other, err := repo.InsertUser(ctx, models.UserRequest{Username: "lifecycle-" + userID})
+	require.NoError(t, err)
+	_, err = repo.InsertUser(ctx, models.UserRequest{Username: "lifecycle-" + userID})
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err), "a taken username is not handed back")
+	_, err = repo.CreateAccount(ctx, models.SignupRequest{Username: "lifecycle-" + userID}, "hash")
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+
+	taken := "lifecycle-" + userID
+	_, err = repo.UpdateUser(ctx, userID, models.UserUpdateRequest{Username: &taken})
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err))
+
+	renamed := "lifecycle_renamed-" + userID
+	user, err := repo.UpdateUser(ctx, userID, models.UserUpdateRequest{Username: &renamed})
+	require.NoError(t, err)
+	assert.Equal(t, renamed, user.Username)
+
+	list, err := repo.ListUsers(ctx, models.UserFilter{Search: "_RENAMED-" + userID, Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, userID, list.Users[0].ID)
+
+	require.NoError(t, repo.DeleteUser(ctx, userID))
+	_, err = repo.GetUser(ctx, userID)
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(err))
+	assert.Equal(t, apperr.KindNotFound, apperr.KindOf(repo.DeleteUser(ctx, userID)))
+
+	var purchases int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM Purchases WHERE user_id = $1`, userID).Scan(&purchases))
+	assert.Zero(t, purchases)
+
+	_, err = repo.GetUser(ctx, other.ID)
+	assert.NoError(t, err)
+}
+
+func TestSetStoreActive_RejectsPurchases(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.NoError(t, err)
+
+	store, err := repo.SetStoreActive(ctx, storeID, false)
+	require.NoError(t, err)
+	assert.False(t, store.IsActive)
+
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	assert.ErrorIs(t, err, repository.ErrStoreInactive)
+
+	sticker, err := repo.GetSticker(ctx, userID, storeID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sticker.StarCount)
+
+	_, err = repo.SetStoreActive(ctx, storeID, true)
+	require.NoError(t, err)
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	assert.NoError(t, err)
+}
+
+func TestEmailVerification(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, _ := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	email := userID + "@example.com"
+	user, err := repo.UpdateEmail(ctx, userID, email)
+	require.NoError(t, err)
+	assert.Equal(t, email, user.Email)
+	assert.False(t, user.EmailVerified)
+
+	_, err = repo.InsertUser(ctx, models.UserRequest{Username: "email-" + userID, Email: strings.ToUpper(email)})
+	assert.Equal(t, apperr.KindConflict, apperr.KindOf(err), "emails are unique regardless of case")
+
+	created, err := repo.InsertUser(ctx, models.UserRequest{Username: "email-" + userID, Email: "created-" + email})
+	require.NoError(t, err)
+	assert.Equal(t, "created-"+email, created.Email)
+	_, err = repo.VerifyEmail(ctx, created.ID, email)
+	assert.ErrorIs(t, err, repository.ErrVerificationStale, "a token only verifies the email stored on its account")
+
+	user, err = repo.VerifyEmail(ctx, userID, email)
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+
+	_, err = repo.UpdateEmail(ctx, userID, "changed-"+email)
+	require.NoError(t, err)
+	_, err = repo.VerifyEmail(ctx, userID, email)
+	assert.ErrorIs(t, err, repository.ErrVerificationStale)
+
+	user, err = repo.GetUser(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	ctx := context.Background()
+
+	user, err := repo.CreateAccount(ctx, models.SignupRequest{Username: "auth-" + time.Now().Format("150405.000000")}, "hash")
+	require.NoError(t, err)
+	t.Cleanup(func() { pool.Exec(ctx, `DELETE FROM Users WHERE user_id = $1`, user.ID) })
+
+	creds, err := repo.GetCredentials(ctx, user.Username)
+	require.NoError(t, err)
+	assert.Equal(t, models.Credentials{UserID: user.ID, PasswordHash: "hash"}, creds)
+
+	require.NoError(t, repo.CreateRefreshToken(ctx, user.ID, strings.Repeat("a", 64), time.Hour))
+
+	userID, err := repo.RotateRefreshToken(ctx, strings.Repeat("a", 64), strings.Repeat("b", 64), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	_, err = repo.RotateRefreshToken(ctx, strings.Repeat("a", 64), strings.Repeat("c", 64), time.Hour)
+	assert.ErrorIs(t, err, repository.ErrInvalidRefreshToken, "a refresh token works once")
+
+	require.NoError(t, repo.RevokeRefreshToken(ctx, strings.Repeat("b", 64)))
+	_, err = repo.RotateRefreshToken(ctx, strings.Repeat("b", 64), strings.Repeat("d", 64), time.Hour)
+	assert.ErrorIs(t, err, repository.ErrInvalidRefreshToken)
+}
+
+func TestStoreAPIKeys(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	_, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	keyHash := strings.ReplaceAll(storeID, "-", "") + strings.Repeat("0", 32)
+	key, err := repo.CreateAPIKey(ctx, storeID, models.APIKeyRequest{Name: "Till 1"}, keyHash)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.ScopePurchasesWrite}, key.Scopes)
+	assert.Nil(t, key.LastUsedAt)
+
+	authed, err := repo.AuthenticateAPIKey(ctx, keyHash)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, authed.ID)
+	assert.NotNil(t, authed.LastUsedAt)
+
+	list, err := repo.ListAPIKeys(ctx, storeID)
+	require.NoError(t, err)
+	require.Len(t, list.APIKeys, 1)
+
+	require.NoError(t, repo.RevokeAPIKey(ctx, storeID, key.ID))
+	_, err = repo.AuthenticateAPIKey(ctx, keyHash)
+	assert.ErrorIs(t, err, repository.ErrInvalidAPIKey)
+
+	err = repo.RevokeAPIKey(ctx, "00000000-0000-0000-0000-000000000000", key.ID)
+	assert.True(t, apperr.Is(err, apperr.KindNotFound), "keys are only revoked through their own store")
+}
+
+func TestUserRoles(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	roles, err := repo.ListRoles(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+
+	operator, err := repo.AssignRole(ctx, userID, models.RoleRequest{Role: models.RoleStoreOperator, StoreID: storeID})
+	require.NoError(t, err)
+	_, err = repo.AssignRole(ctx, userID, models.RoleRequest{Role: models.RoleAdmin})
+	require.NoError(t, err)
+	_, err = repo.AssignRole(ctx, userID, models.RoleRequest{Role: models.RoleAdmin})
+	assert.True(t, apperr.Is(err, apperr.KindConflict), "a role is granted once")
+
+	roles, err = repo.ListRoles(ctx, userID)
+	require.NoError(t, err)
+	assert.True(t, roles.IsAdmin())
+	assert.True(t, roles.Operates(storeID))
+
+	require.NoError(t, repo.RevokeRole(ctx, userID, operator.ID))
+	roles, err = repo.ListRoles(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, roles.Operates(storeID))
+}
+
+func TestUpdateLevel(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	levels, err := repo.ListLevels(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, levels.Levels)
+	first, last := levels.Levels[0], levels.Levels[len(levels.Levels)-1]
+	t.Cleanup(func() {
+		repo.UpdateLevel(ctx, first.Level, models.LevelUpdateRequest{StarsRequired: first.StarsRequired})
+	})
+
+	updated, err := repo.UpdateLevel(ctx, first.Level, models.LevelUpdateRequest{StarsRequired: first.StarsRequired + 1})
+	require.NoError(t, err)
+	assert.Equal(t, first.StarsRequired+1, updated.StarsRequired)
+
+	_, err = repo.UpdateLevel(ctx, last.Level, models.LevelUpdateRequest{StarsRequired: 1})
+	assert.ErrorIs(t, err, repository.ErrTerminalLevel)
+
+	_, err = repo.UpdateLevel(ctx, "no-such-level", models.LevelUpdateRequest{StarsRequired: 1})
+	assert.True(t, apperr.Is(err, apperr.KindNotFound))
+}
+
+func TestGetStoreStats(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	stats, err := repo.GetStoreStats(ctx, storeID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StoreStats{StoreID: storeID, StickersByLevel: map[string]int{}}, stats)
+
+	for i := 0; i < 2; i++ {
+		_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+		require.NoError(t, err)
+	}
+	stats, err = repo.GetStoreStats(ctx, storeID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Purchases)
+	assert.Equal(t, 2, stats.PurchasesLast30Days)
+	assert.Equal(t, 1, stats.Customers)
+	assert.Equal(t, 1, len(stats.StickersByLevel))
+
+	_, err = repo.GetStoreStats(ctx, "00000000-0000-0000-0000-000000000000")
+	assert.True(t, apperr.Is(err, apperr.KindNotFound))
+}
+
+func TestGetStickersByUser_Pagination(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, _ := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	// One sticker per store, with 1, 2 and 3 stars.
+	for stars := 1; stars <= 3; stars++ {
+		var storeID string
+		require.NoError(t, pool.QueryRow(ctx,
+			`INSERT INTO Stores (store_name, sticker_theme) VALUES ('Paged Store', 'paged') RETURNING store_id`).Scan(&storeID))
+		for i := 0; i < stars; i++ {
+			_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+			require.NoError(t, err)
+		}
+	}
+
+	filter := models.StickerFilter{Sort: models.StickerSortStarCount, Descending: true, Page: pagination.Page{Limit: 2}}
+	first, err := repo.GetStickersByUser(ctx, userID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, 3, first.Total)
+	require.Len(t, first.Stickers, 2)
+	assert.Equal(t, []int{3, 2}, []int{first.Stickers[0].StarCount, first.Stickers[1].StarCount})
+	require.NotEmpty(t, first.NextCursor)
+
+	cursor, err := pagination.Decode(first.NextCursor)
+	require.NoError(t, err)
+	filter.Page.After = &cursor
+	second, err := repo.GetStickersByUser(ctx, userID, filter)
+	require.NoError(t, err)
+	require.Len(t, second.Stickers, 1)
+	assert.Equal(t, 1, second.Stickers[0].StarCount)
+	assert.Empty(t, second.NextCursor)
+
+	filtered, err := repo.GetStickersByUser(ctx, userID, models.StickerFilter{
+		StickerTheme: "paged", Sort: models.StickerSortLevel, Page: pagination.Page{Limit: 10},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, filtered.Total)
+
+	filter.Page.After = &pagination.Cursor{Value: "yesterday", ID: cursor.ID}
+	_, err = repo.GetStickersByUser(ctx, userID, filter)
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+}
+
+func TestGetSticker_Progress(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	levels, err := repo.ListLevels(ctx)
+	require.NoError(t, err)
+	first := levels.Levels[0]
+
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.NoError(t, err)
+
+	sticker, err := repo.GetSticker(ctx, userID, storeID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, sticker.StickerID)
+	assert.Equal(t, storeID, sticker.StoreID)
+	assert.Equal(t, first.Level, sticker.Level)
+	assert.Equal(t, first.NextLevel, sticker.NextLevel)
+	assert.Equal(t, first.StarsRequired-1, sticker.StarsToNextLevel)
+	assert.False(t, sticker.LastUpdated.IsZero())
+
+	// Stickers already at the last level have nothing left to earn.
+	last := levels.Levels[len(levels.Levels)-1]
+	_, err = pool.Exec(ctx, `UPDATE User_Sticker_Progress SET current_level = $1 WHERE user_id = $2`, last.Level, userID)
+	require.NoError(t, err)
+	page, err := repo.GetStickersByUser(ctx, userID, models.StickerFilter{Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, page.Stickers, 1)
+	assert.Empty(t, page.Stickers[0].NextLevel)
+	assert.Zero(t, page.Stickers[0].StarsToNextLevel)
+}
+
+// relayOutbox publishes everything in the outbox.
+func relayOutbox(t *testing.T, repo *repository.Repository, publisher outbox.Publisher) {
+	t.Helper()
+	relay := outbox.NewRelay(repo, publisher)
+	for {
+		n, err := relay.RelayOnce(context.Background())
+		require.NoError(t, err)
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func TestOutbox_WrittenWithPurchases(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+	relayOutbox(t, repo, outbox.PublisherFunc(func(context.Context, models.OutboxMessage) error { return nil }))
+
+	for range 5 {
+		_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+		require.NoError(t, err)
+	}
+	// A purchase that rolls back leaves nothing to publish.
+	_, err := pool.Exec(ctx, `UPDATE Stores SET is_active = false WHERE store_id = $1`, storeID)
+	require.NoError(t, err)
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.Error(t, err)
+
+	var published []models.OutboxMessage
+	relayOutbox(t, repo, outbox.PublisherFunc(func(_ context.Context, m models.OutboxMessage) error {
+		if m.UserID == userID {
+			published = append(published, m)
+		}
+		return nil
+	}))
+
+	// The fifth star levels the sticker up.
+	require.Len(t, published, 6)
+	for i, m := range published {
+		assert.Equal(t, storeID, m.StoreID)
+		if i > 0 {
+			assert.Greater(t, m.ID, published[i-1].ID)
+		}
+	}
+	assert.Equal(t, models.EventLevelUp, published[5].EventType)
+	var event models.StickerEvent
+	require.NoError(t, json.Unmarshal(published[4].Payload, &event))
+	assert.Equal(t, models.StickerEvent{UserID: userID, StoreID: storeID, Level: "silver", StarCount: 0}, event)
+
+	// Once sent, nothing is published again.
+	relayOutbox(t, repo, outbox.PublisherFunc(func(_ context.Context, m models.OutboxMessage) error {
+		assert.NotEqual(t, userID, m.UserID)
+		return nil
+	}))
+}
+
+// userMessages keeps the messages of userID.
+func userMessages(messages []models.OutboxMessage, userID string) []int64 {
+	var ids []int64
+	for _, m := range messages {
+		if m.UserID == userID {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+func TestClaimOutbox_HoldsMessagesUntilSentOrExpired(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+	relayOutbox(t, repo, outbox.PublisherFunc(func(context.Context, models.OutboxMessage) error { return nil }))
+
+	for range 2 {
+		_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+		require.NoError(t, err)
+	}
+	claimed, err := repo.ClaimOutbox(ctx, 1000, time.Minute)
+	require.NoError(t, err)
+	ids := userMessages(claimed, userID)
+	require.Len(t, ids, 2)
+
+	// Held messages are not claimed again, nor are the user's later ones.
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.NoError(t, err)
+	claimed, err = repo.ClaimOutbox(ctx, 1000, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, userMessages(claimed, userID))
+
+	// Once the first is sent and the second's claim runs out, both unsent
+	// messages are claimed in order.
+	require.NoError(t, repo.MarkOutboxSent(ctx, ids[:1]))
+	_, err = pool.Exec(ctx, `UPDATE Outbox SET claimed_until = now() - interval '1 second' WHERE outbox_id = $1`, ids[1])
+	require.NoError(t, err)
+	claimed, err = repo.ClaimOutbox(ctx, 1000, time.Minute)
+	require.NoError(t, err)
+	again := userMessages(claimed, userID)
+	require.Len(t, again, 2)
+	assert.Equal(t, ids[1], again[0])
+	require.NoError(t, repo.MarkOutboxSent(ctx, again))
+}
+
+func TestPruneOutbox_DeletesOldSentMessages(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+		require.NoError(t, err)
+	}
+	relayOutbox(t, repo, outbox.PublisherFunc(func(context.Context, models.OutboxMessage) error { return nil }))
+	_, err := pool.Exec(ctx, `UPDATE Outbox SET sent_at = now() - interval '2 hours'
+		WHERE outbox_id = (SELECT min(outbox_id) FROM Outbox WHERE user_id = $1)`, userID)
+	require.NoError(t, err)
+
+	n, err := repo.PruneOutbox(ctx, time.Hour, 1000)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+
+	var left int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM Outbox WHERE user_id = $1`, userID).Scan(&left))
+	assert.Equal(t, 2, left)
+}
+
+func TestEnqueueWebhooks_Idempotent(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	_, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	hook, err := repo.CreateWebhook(ctx, storeID,
+		models.WebhookRequest{URL: "https://partner.example.com/hooks", EventTypes: []string{models.EventLevelUp}}, webhook.NewSecret())
+	require.NoError(t, err)
+
+	message := models.OutboxMessage{ID: 1 << 40, EventType: models.EventLevelUp, StoreID: storeID,
+		Payload: json.RawMessage(`{"level":"silver"}`), CreatedAt: time.Now().UTC()}
+	require.NoError(t, repo.EnqueueWebhooks(ctx, message))
+	require.NoError(t, repo.EnqueueWebhooks(ctx, message))
+
+	log, err := repo.ListWebhookDeliveries(ctx, storeID, hook.ID, models.WebhookDeliveryFilter{Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	assert.Len(t, log.Deliveries, 1)
+}
+
+func TestWebhooks_DeliveredFromPurchases(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	received := make(chan webhook.Envelope, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var e webhook.Envelope
+		if json.Unmarshal(body, &e) == nil {
+			received <- e
+		}
+	}))
+	defer receiver.Close()
+
+	hook, err := repo.CreateWebhook(ctx, storeID,
+		models.WebhookRequest{URL: receiver.URL, EventTypes: []string{models.EventStarAwarded}}, webhook.NewSecret())
+	require.NoError(t, err)
+	other, err := repo.CreateWebhook(ctx, storeID,
+		models.WebhookRequest{URL: receiver.URL, EventTypes: []string{models.EventLevelUp}}, webhook.NewSecret())
+	require.NoError(t, err)
+
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.NoError(t, err)
+	relayOutbox(t, repo, outbox.Webhooks(repo))
+
+	// Only the webhook that asked for star_awarded is sent the purchase.
+	pending, err := repo.ListWebhookDeliveries(ctx, storeID, hook.ID,
+		models.WebhookDeliveryFilter{Status: models.DeliveryPending, Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, pending.Deliveries, 1)
+	assert.Equal(t, models.EventStarAwarded, pending.Deliveries[0].EventType)
+	none, err := repo.ListWebhookDeliveries(ctx, storeID, other.ID, models.WebhookDeliveryFilter{Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	assert.Empty(t, none.Deliveries)
+
+	_, err = webhook.NewDispatcher(repo, webhook.WithClient(receiver.Client())).DispatchOnce(ctx)
+	require.NoError(t, err)
+
+	select {
+	case e := <-received:
+		assert.Equal(t, pending.Deliveries[0].ID, e.ID)
+		assert.JSONEq(t, `{"user_id":"`+userID+`","store_id":"`+storeID+`","level":"bronze","star_count":1}`, string(e.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	log, err := repo.ListWebhookDeliveries(ctx, storeID, hook.ID, models.WebhookDeliveryFilter{Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, log.Deliveries, 1)
+	delivery := log.Deliveries[0]
+	assert.Equal(t, models.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	require.NotNil(t, delivery.LastStatusCode)
+	assert.Equal(t, http.StatusOK, *delivery.LastStatusCode)
+	assert.NotNil(t, delivery.DeliveredAt)
+
+	// Another store cannot read the log.
+	_, otherStore := createUserAndStore(t, pool)
+	hidden, err := repo.ListWebhookDeliveries(ctx, otherStore, hook.ID, models.WebhookDeliveryFilter{Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	assert.Empty(t, hidden.Deliveries)
+
+	require.NoError(t, repo.DeleteWebhook(ctx, storeID, hook.ID))
+	assert.True(t, apperr.Is(repo.DeleteWebhook(ctx, storeID, hook.ID), apperr.KindNotFound))
+}
+
+func TestRecordWebhookAttempt_DeadLetter(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	userID, storeID := createUserAndStore(t, pool)
+	ctx := context.Background()
+
+	hook, err := repo.CreateWebhook(ctx, storeID,
+		models.WebhookRequest{URL: "http://127.0.0.1:1/hook", EventTypes: []string{models.EventStarAwarded}}, webhook.NewSecret())
+	require.NoError(t, err)
+	_, err = repo.UpsertStar(ctx, models.PurchaseRequest{UserID: userID, StoreID: storeID})
+	require.NoError(t, err)
+	relayOutbox(t, repo, outbox.Webhooks(repo))
+	log, err := repo.ListWebhookDeliveries(ctx, storeID, hook.ID, models.WebhookDeliveryFilter{Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, log.Deliveries, 1)
+	id := log.Deliveries[0].ID
+
+	require.NoError(t, repo.RecordWebhookAttempt(ctx, id,
+		models.WebhookAttempt{Status: models.DeliveryPending, Error: "connection refused", RetryIn: time.Hour}))
+	require.NoError(t, repo.RecordWebhookAttempt(ctx, id,
+		models.WebhookAttempt{Status: models.DeliveryDead, StatusCode: http.StatusGone, Error: "unexpected status 410 Gone"}))
+
+	dead, err := repo.ListWebhookDeliveries(ctx, storeID, hook.ID,
+		models.WebhookDeliveryFilter{Status: models.DeliveryDead, Page: pagination.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, dead.Deliveries, 1)
+	assert.Equal(t, 2, dead.Deliveries[0].Attempts)
+	assert.Equal(t, "unexpected status 410 Gone", dead.Deliveries[0].LastError)
+	assert.Nil(t, dead.Deliveries[0].DeliveredAt)
+
+	assert.True(t, apperr.Is(repo.RecordWebhookAttempt(ctx, "00000000-0000-0000-0000-000000000000",
+		models.WebhookAttempt{Status: models.DeliveryDead}), apperr.KindNotFound))
+}
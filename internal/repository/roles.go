@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+const roleColumns = `role_id, user_id, role, COALESCE(store_id::text, ''), created_at`
+
+// ListRoles returns the roles granted to a user, oldest first. Users without
+// any are plain customers.
+func (r *Repository) ListRoles(ctx context.Context, userID string) (models.Roles, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+roleColumns+` FROM User_Roles WHERE user_id = $1 ORDER BY created_at, role_id`, userID)
+	if err != nil {
+		return nil, mapError(err, "user not found")
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.RoleAssignment])
+	if err != nil {
+		return nil, mapError(err, "user not found")
+	}
+	if roles == nil {
+		roles = models.Roles{}
+	}
+	return roles, nil
+}
+
+// AssignRole grants a user a role, failing with a conflict when they already
+// hold it.
+func (r *Repository) AssignRole(ctx context.Context, userID string, req models.RoleRequest) (models.RoleAssignment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`INSERT INTO User_Roles (user_id, role, store_id) VALUES ($1, $2, NULLIF($3, '')::uuid)
+		RETURNING `+roleColumns, userID, req.Role, req.StoreID)
+	if err != nil {
+		return models.RoleAssignment{}, mapError(err, "user not found")
+	}
+	role, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.RoleAssignment])
+	if err != nil {
+		return models.RoleAssignment{}, mapError(err, "user not found")
+	}
+	return role, nil
+}
+
+func (r *Repository) RevokeRole(ctx context.Context, userID, roleID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM User_Roles WHERE user_id = $1 AND role_id = $2`, userID, roleID)
+	if err != nil {
+		return mapError(err, "role assignment not found")
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.NotFound("role assignment not found")
+	}
+	return nil
+}
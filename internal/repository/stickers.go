@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+)
+
+// stickerColumns reads a UserStickerResponse. Progress comes from the level
+// requirements as they are now, and counts as complete when a lowered
+// requirement is already met.
+const stickerColumns = `s.user_sticker_id, s.store_id, st.store_name, COALESCE(st.location, ''),
+	COALESCE(st.sticker_theme, ''), s.star_count, s.current_level, COALESCE(l.next_level, ''),
+	CASE WHEN l.next_level IS NULL THEN 0 ELSE GREATEST(l.stars_required - s.star_count, 0) END,
+	s.last_updated`
+
+const stickerFrom = ` FROM User_Sticker_Progress s
+	JOIN Stores st ON s.store_id = st.store_id
+	JOIN Sticker_Level_Requirements l ON l.level = s.current_level`
+
+// GetStickersByUser pages through a user's stickers in the order filter asks
+// for, breaking ties by sticker ID so pages never overlap.
+func (r *Repository) GetStickersByUser(ctx context.Context, userID string, filter models.StickerFilter) (models.StickerByUserResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM Users WHERE user_id = $1)`, userID).Scan(&exists)
+	if err != nil {
+		return models.StickerByUserResponse{}, mapError(err, "user not found")
+	}
+	if !exists {
+		return models.StickerByUserResponse{}, apperr.NotFound("user not found")
+	}
+
+	from := stickerFrom + ` WHERE s.user_id = $1`
+	args := []any{userID}
+	if filter.Level != "" {
+		args = append(args, filter.Level)
+		from += fmt.Sprintf(` AND s.current_level = $%d`, len(args))
+	}
+	if filter.StickerTheme != "" {
+		args = append(args, filter.StickerTheme)
+		from += fmt.Sprintf(` AND st.sticker_theme = $%d`, len(args))
+	}
+
+	resp := models.StickerByUserResponse{Stickers: []models.UserStickerResponse{}}
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*)`+from, args...).Scan(&resp.Total); err != nil {
+		return models.StickerByUserResponse{}, mapError(err, "user not found")
+	}
+
+	var key string
+	// ranks numbers levels by their position in the level chain.
+	ranks := map[string]int{}
+	switch filter.Sort {
+	case models.StickerSortLevel:
+		rules, err := levelRules(ctx, r.pool)
+		if err != nil {
+			return models.StickerByUserResponse{}, mapError(err, "user not found")
+		}
+		var chain []string
+		for level := rules.Initial(); level != ""; {
+			ranks[level] = len(chain) + 1
+			chain = append(chain, level)
+			req, _ := rules.Requirement(level)
+			level = req.NextLevel
+		}
+		args = append(args, chain)
+		key = fmt.Sprintf(`array_position($%d::text[], s.current_level)`, len(args))
+	case models.StickerSortStarCount:
+		key = `s.star_count`
+	default:
+		key = `s.last_updated`
+	}
+
+	query := `SELECT ` + stickerColumns + from
+	if after := filter.Page.After; after != nil {
+		value, err := stickerCursorValue(filter.Sort, after.Value)
+		if err != nil {
+			return models.StickerByUserResponse{}, err
+		}
+		cmp := ">"
+		if filter.Descending {
+			cmp = "<"
+		}
+		args = append(args, value, after.ID)
+		query += fmt.Sprintf(` AND (%s, s.user_sticker_id) %s ($%d, $%d::uuid)`, key, cmp, len(args)-1, len(args))
+	}
+
+	dir := "ASC"
+	if filter.Descending {
+		dir = "DESC"
+	}
+	args = append(args, filter.Page.Limit+1)
+	query += fmt.Sprintf(` ORDER BY %s %s, s.user_sticker_id %s LIMIT $%d`, key, dir, dir, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return models.StickerByUserResponse{}, mapError(err, "user not found")
+	}
+
+	stickers, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.UserStickerResponse])
+	if err != nil {
+		return models.StickerByUserResponse{}, mapError(err, "user not found")
+	}
+
+	if len(stickers) > filter.Page.Limit {
+		stickers = stickers[:filter.Page.Limit]
+		last := stickers[len(stickers)-1]
+		cursor := pagination.Cursor{ID: last.StickerID}
+		switch filter.Sort {
+		case models.StickerSortLevel:
+			cursor.Value = strconv.Itoa(ranks[last.Level])
+		case models.StickerSortStarCount:
+			cursor.Value = strconv.Itoa(last.StarCount)
+		default:
+			cursor.Value = last.LastUpdated.Format(time.RFC3339Nano)
+		}
+		resp.NextCursor = pagination.Encode(cursor)
+	}
+	if stickers != nil {
+		resp.Stickers = stickers
+	}
+
+	return resp, nil
+}
+
+// stickerCursorValue parses the sort value a sticker cursor was encoded with.
+func stickerCursorValue(sort, value string) (any, error) {
+	if sort == models.StickerSortLevel || sort == models.StickerSortStarCount {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, pagination.ErrInvalidCursor
+	}
+	return t, nil
+}
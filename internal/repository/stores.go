@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+)
+
+const storeColumns = `store_id, store_name, COALESCE(location, ''), COALESCE(sticker_theme, ''), is_active`
+
+func (r *Repository) GetStore(ctx context.Context, storeID string) (models.Store, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx, `SELECT `+storeColumns+` FROM Stores WHERE store_id = $1`, storeID)
+	if err != nil {
+		return models.Store{}, mapError(err, "store not found")
+	}
+	store, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.Store])
+	if err != nil {
+		return models.Store{}, mapError(err, "store not found")
+	}
+	return store, nil
+}
+
+// UpdateStore applies the non-nil fields of req and returns the updated store.
+func (r *Repository) UpdateStore(ctx context.Context, storeID string, req models.StoreUpdateRequest) (models.Store, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`UPDATE Stores SET
+			store_name = COALESCE($2, store_name),
+			location = CASE WHEN $3::text IS NULL THEN location ELSE NULLIF($3, '') END,
+			sticker_theme = CASE WHEN $4::text IS NULL THEN sticker_theme ELSE NULLIF($4, '') END
+		WHERE store_id = $1
+		RETURNING `+storeColumns, storeID, req.Name, req.Location, req.StickerTheme)
+	if err != nil {
+		return models.Store{}, mapError(err, "store not found")
+	}
+	store, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.Store])
+	if err != nil {
+		return models.Store{}, mapError(err, "store not found")
+	}
+	return store, nil
+}
+
+// SetStoreActive deactivates or reactivates a store. Inactive stores reject
+// new purchases but their stickers and ledger stay readable.
+func (r *Repository) SetStoreActive(ctx context.Context, storeID string, active bool) (models.Store, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`UPDATE Stores SET is_active = $2 WHERE store_id = $1 RETURNING `+storeColumns, storeID, active)
+	if err != nil {
+		return models.Store{}, mapError(err, "store not found")
+	}
+	store, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.Store])
+	if err != nil {
+		return models.Store{}, mapError(err, "store not found")
+	}
+	return store, nil
+}
+
+// ListStores pages through stores ordered by name.
+func (r *Repository) ListStores(ctx context.Context, filter models.StoreFilter) (models.StoreListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + storeColumns + ` FROM Stores WHERE TRUE`
+	var args []any
+
+	if filter.Active != nil {
+		args = append(args, *filter.Active)
+		query += fmt.Sprintf(` AND is_active = $%d`, len(args))
+	}
+	if filter.StickerTheme != "" {
+		args = append(args, filter.StickerTheme)
+		query += fmt.Sprintf(` AND sticker_theme = $%d`, len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, likeEscaper.Replace(filter.Search))
+		query += fmt.Sprintf(` AND store_name ILIKE '%%' || $%d || '%%'`, len(args))
+	}
+	if after := filter.Page.After; after != nil {
+		args = append(args, after.Value, after.ID)
+		query += fmt.Sprintf(` AND (store_name, store_id) > ($%d, $%d::uuid)`, len(args)-1, len(args))
+	}
+
+	args = append(args, filter.Page.Limit+1)
+	query += fmt.Sprintf(` ORDER BY store_name, store_id LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return models.StoreListResponse{}, mapError(err, "store not found")
+	}
+	stores, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Store])
+	if err != nil {
+		return models.StoreListResponse{}, mapError(err, "store not found")
+	}
+
+	resp := models.StoreListResponse{Stores: stores}
+	if len(stores) > filter.Page.Limit {
+		resp.Stores = stores[:filter.Page.Limit]
+		last := resp.Stores[len(resp.Stores)-1]
+		resp.NextCursor = pagination.Encode(pagination.Cursor{Value: last.Name, ID: last.ID})
+	}
+	if resp.Stores == nil {
+		resp.Stores = []models.Store{}
+	}
+
+	return resp, nil
+}
+
+// GetStoreStats summarizes a store's purchases and the stickers its customers
+// hold.
+func (r *Repository) GetStoreStats(ctx context.Context, storeID string) (models.StoreStats, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	stats := models.StoreStats{StoreID: storeID, StickersByLevel: map[string]int{}}
+	err := r.pool.QueryRow(ctx,
+		`SELECT COUNT(p.purchase_id),
+			COUNT(p.purchase_id) FILTER (WHERE p.purchase_time >= CURRENT_TIMESTAMP - INTERVAL '30 days'),
+			COUNT(DISTINCT p.user_id)
+		FROM Stores s LEFT JOIN Purchases p ON p.store_id = s.store_id
+		WHERE s.store_id = $1
+		GROUP BY s.store_id`, storeID).
+		Scan(&stats.Purchases, &stats.PurchasesLast30Days, &stats.Customers)
+	if err != nil {
+		return models.StoreStats{}, mapError(err, "store not found")
+	}
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT current_level, COUNT(*) FROM User_Sticker_Progress WHERE store_id = $1 GROUP BY current_level`, storeID)
+	if err != nil {
+		return models.StoreStats{}, mapError(err, "store not found")
+	}
+	var level string
+	var count int
+	_, err = pgx.ForEachRow(rows, []any{&level, &count}, func() error {
+		stats.StickersByLevel[level] = count
+		return nil
+	})
+	if err != nil {
+		return models.StoreStats{}, mapError(err, "store not found")
+	}
+	return stats, nil
+}
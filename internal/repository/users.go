@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+const userColumns = `user_id, username, COALESCE(email, ''), email_verified_at IS NOT NULL, created_at`
+
+// ErrVerificationStale is returned when a verification token names an email
+// the user no longer has.
+var ErrVerificationStale = apperr.Unprocessable("verification token does not match the user's current email")
+
+func (r *Repository) GetUser(ctx context.Context, userID string) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.queryUser(ctx, `SELECT `+userColumns+` FROM Users WHERE user_id = $1`, userID)
+}
+
+// UpdateUser applies the non-nil fields of req and returns the updated user.
+func (r *Repository) UpdateUser(ctx context.Context, userID string, req models.UserUpdateRequest) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.queryUser(ctx,
+		`UPDATE Users SET username = COALESCE($2, username) WHERE user_id = $1
+		RETURNING `+userColumns, userID, req.Username)
+}
+
+// UpdateEmail replaces the user's email and marks it unverified until the new
+// address is confirmed.
+func (r *Repository) UpdateEmail(ctx context.Context, userID, email string) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.queryUser(ctx,
+		`UPDATE Users SET email = $2, email_verified_at = NULL WHERE user_id = $1
+		RETURNING `+userColumns, userID, email)
+}
+
+// VerifyEmail marks email as verified if it is still the user's address.
+// Verifying twice keeps the original verification time.
+func (r *Repository) VerifyEmail(ctx context.Context, userID, email string) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	user, err := r.queryUser(ctx,
+		`UPDATE Users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE user_id = $1 AND lower(email) = lower($2)
+		RETURNING `+userColumns, userID, email)
+	if apperr.Is(err, apperr.KindNotFound) {
+		return models.User{}, ErrVerificationStale
+	}
+	return user, err
+}
+
+func (r *Repository) queryUser(ctx context.Context, sql string, args ...any) (models.User, error) {
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return models.User{}, mapError(err, "user not found")
+	}
+	user, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.User])
+	if err != nil {
+		return models.User{}, mapError(err, "user not found")
+	}
+	return user, nil
+}
+
+// DeleteUser removes the user together with their stickers and purchases.
+func (r *Repository) DeleteUser(ctx context.Context, userID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM Users WHERE user_id = $1`, userID)
+	if err != nil {
+		return mapError(err, "user not found")
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.NotFound("user not found")
+	}
+	return nil
+}
+
+// ListUsers pages through users ordered by username. Search matches any part
+// of the username, case-insensitively.
+func (r *Repository) ListUsers(ctx context.Context, filter models.UserFilter) (models.UserListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + userColumns + ` FROM Users WHERE TRUE`
+	var args []any
+
+	if filter.Search != "" {
+		args = append(args, likeEscaper.Replace(filter.Search))
+		query += fmt.Sprintf(` AND username ILIKE '%%' || $%d || '%%'`, len(args))
+	}
+	if after := filter.Page.After; after != nil {
+		args = append(args, after.Value, after.ID)
+		query += fmt.Sprintf(` AND (username, user_id) > ($%d, $%d::uuid)`, len(args)-1, len(args))
+	}
+
+	args = append(args, filter.Page.Limit+1)
+	query += fmt.Sprintf(` ORDER BY username, user_id LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return models.UserListResponse{}, mapError(err, "user not found")
+	}
+	users, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.User])
+	if err != nil {
+		return models.UserListResponse{}, mapError(err, "user not found")
+	}
+
+	resp := models.UserListResponse{Users: users}
+	if len(users) > filter.Page.Limit {
+		resp.Users = users[:filter.Page.Limit]
+		last := resp.Users[len(resp.Users)-1]
+		resp.NextCursor = pagination.Encode(pagination.Cursor{Value: last.Username, ID: last.ID})
+	}
+	if resp.Users == nil {
+		resp.Users = []models.User{}
+	}
+
+	return resp, nil
+}
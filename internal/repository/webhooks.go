@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/m-garey/fetchit-backend/internal/pagination"
+)
+
+const (
+	webhookColumns  = `webhook_id, store_id, url, event_types, created_at`
+	deliveryColumns = `d.delivery_id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.last_status_code, COALESCE(d.last_error, ''), d.created_at, d.delivered_at`
+)
+
+// CreateWebhook registers a URL for a store's events. Unlike API keys the
+// secret is kept as is, since every delivery has to be signed with it.
+func (r *Repository) CreateWebhook(ctx context.Context, storeID string, req models.WebhookRequest, secret string) (models.Webhook, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`INSERT INTO Webhooks (store_id, url, event_types, secret) VALUES ($1, $2, $3, $4)
+		RETURNING `+webhookColumns, storeID, req.URL, req.EventTypes, secret)
+	if err != nil {
+		return models.Webhook{}, mapError(err, "store not found")
+	}
+	webhook, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByPos[models.Webhook])
+	if err != nil {
+		return models.Webhook{}, mapError(err, "store not found")
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns every webhook of a store, oldest first.
+func (r *Repository) ListWebhooks(ctx context.Context, storeID string) (models.WebhookListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+webhookColumns+` FROM Webhooks WHERE store_id = $1 ORDER BY created_at, webhook_id`, storeID)
+	if err != nil {
+		return models.WebhookListResponse{}, mapError(err, "store not found")
+	}
+	webhooks, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Webhook])
+	if err != nil {
+		return models.WebhookListResponse{}, mapError(err, "store not found")
+	}
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+	return models.WebhookListResponse{Webhooks: webhooks}, nil
+}
+
+// DeleteWebhook removes a store's webhook along with its delivery log.
+func (r *Repository) DeleteWebhook(ctx context.Context, storeID, webhookID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM Webhooks WHERE store_id = $1 AND webhook_id = $2`, storeID, webhookID)
+	if err != nil {
+		return mapError(err, "webhook not found")
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.NotFound("webhook not found")
+	}
+	return nil
+}
+
+// ListWebhookDeliveries pages through a store webhook's deliveries newest
+// first.
+func (r *Repository) ListWebhookDeliveries(ctx context.Context, storeID, webhookID string, filter models.WebhookDeliveryFilter) (models.WebhookDeliveryListResponse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + deliveryColumns + ` FROM Webhook_Deliveries d
+	JOIN Webhooks w ON w.webhook_id = d.webhook_id
+	WHERE w.store_id = $1 AND d.webhook_id = $2`
+	args := []any{storeID, webhookID}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(` AND d.status = $%d`, len(args))
+	}
+	if after := filter.Page.After; after != nil {
+		t, err := time.Parse(time.RFC3339Nano, after.Value)
+		if err != nil {
+			return models.WebhookDeliveryListResponse{}, pagination.ErrInvalidCursor
+		}
+		args = append(args, t, after.ID)
+		query += fmt.Sprintf(` AND (d.created_at, d.delivery_id) < ($%d, $%d::uuid)`, len(args)-1, len(args))
+	}
+
+	args = append(args, filter.Page.Limit+1)
+	query += fmt.Sprintf(` ORDER BY d.created_at DESC, d.delivery_id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return models.WebhookDeliveryListResponse{}, mapError(err, "webhook not found")
+	}
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.WebhookDelivery])
+	if err != nil {
+		return models.WebhookDeliveryListResponse{}, mapError(err, "webhook not found")
+	}
+
+	resp := models.WebhookDeliveryListResponse{Deliveries: deliveries}
+	if len(deliveries) > filter.Page.Limit {
+		resp.Deliveries = deliveries[:filter.Page.Limit]
+		last := resp.Deliveries[len(resp.Deliveries)-1]
+		resp.NextCursor = pagination.Encode(pagination.Cursor{
+			Value: last.CreatedAt.Format(time.RFC3339Nano),
+			ID:    last.ID,
+		})
+	}
+	if resp.Deliveries == nil {
+		resp.Deliveries = []models.WebhookDelivery{}
+	}
+
+	return resp, nil
+}
+
+// ClaimWebhookDeliveries picks up to limit pending deliveries that are due
+// and pushes their next attempt back by lease, so a dispatcher that dies
+// mid-send has them retried once the lease runs out. SKIP LOCKED lets several
+// instances claim side by side.
+func (r *Repository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.DueWebhookDelivery, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx,
+		`WITH due AS (
+			SELECT delivery_id FROM Webhook_Deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE Webhook_Deliveries d SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due, Webhooks w
+		WHERE d.delivery_id = due.delivery_id AND w.webhook_id = d.webhook_id
+		RETURNING d.delivery_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, mapError(err, "webhook delivery not found")
+	}
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.DueWebhookDelivery])
+	if err != nil {
+		return nil, mapError(err, "webhook delivery not found")
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt stores the outcome of sending a delivery.
+func (r *Repository) RecordWebhookAttempt(ctx context.Context, deliveryID string, attempt models.WebhookAttempt) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE Webhook_Deliveries SET attempts = attempts + 1, status = $2,
+		last_status_code = NULLIF($3, 0), last_error = NULLIF($4, ''),
+		next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $5),
+		delivered_at = CASE WHEN $2 = 'delivered' THEN CURRENT_TIMESTAMP END
+		WHERE delivery_id = $1`,
+		deliveryID, attempt.Status, attempt.StatusCode, attempt.Error, attempt.RetryIn.Seconds())
+	if err != nil {
+		return mapError(err, "webhook delivery not found")
+	}
+	if tag.RowsAffected() == 0 {
+		return apperr.NotFound("webhook delivery not found")
+	}
+	return nil
+}
+
+// EnqueueWebhooks queues a delivery of an outbox message for every webhook of
+// its store that asked for its type. A message that was already queued is
+// skipped, so the relay may publish it more than once.
+func (r *Repository) EnqueueWebhooks(ctx context.Context, message models.OutboxMessage) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO Webhook_Deliveries (webhook_id, outbox_id, event_type, payload, created_at)
+		SELECT webhook_id, $1, $3::text, $4::jsonb, $5 FROM Webhooks WHERE store_id = $2 AND $3::text = ANY(event_types)
+		ON CONFLICT (webhook_id, outbox_id) DO NOTHING`,
+		message.ID, message.StoreID, message.EventType, message.Payload, message.CreatedAt)
+	if err != nil {
+		return mapError(err, "store not found")
+	}
+	return nil
+}
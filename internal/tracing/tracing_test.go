@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/m-garey/fetchit-backend/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// record installs a tracer provider that keeps every span in memory.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func attributes(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	recorder := record(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/api/users/:user_id", func(c *gin.Context) {
+		_, child := otel.Tracer("test").Start(c.Request.Context(), "child")
+		child.End()
+		c.Error(errors.New("database is down"))
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/alice", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+
+	assert.Equal(t, "GET /api/users/:user_id", server.Name())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	attrs := attributes(server)
+	assert.Equal(t, "/api/users/:user_id", attrs["http.route"].AsString())
+	assert.Equal(t, "/api/users/alice", attrs["url.path"].AsString())
+	assert.Equal(t, int64(500), attrs["http.response.status_code"].AsInt64())
+	require.Len(t, server.Events(), 1)
+	assert.Equal(t, "exception", server.Events()[0].Name)
+
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+server.SpanContext().SpanID().String()+"-01",
+		w.Header().Get("traceparent"))
+}
+
+func TestMiddleware_StartsNewTrace(t *testing.T) {
+	recorder := record(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET", spans[0].Name())
+	assert.False(t, spans[0].Parent().IsValid())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := record(t)
+	tracer := NewQueryTracer()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+
+	sql := `INSERT INTO Purchases (user_id, store_id, source) VALUES ($1, $2, $3) RETURNING purchase_id`
+	qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql})
+	tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("INSERT 0 1")})
+
+	qctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: `SELECT is_active FROM Stores WHERE store_id = $1`})
+	tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{Err: errors.New("connection reset")})
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	insert, selectStore := spans[0], spans[1]
+
+	assert.Equal(t, "INSERT Purchases", insert.Name())
+	assert.Equal(t, trace.SpanKindClient, insert.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), insert.Parent().SpanID())
+	attrs := attributes(insert)
+	assert.Equal(t, "postgresql", attrs["db.system.name"].AsString())
+	assert.Equal(t, "INSERT", attrs["db.operation.name"].AsString())
+	assert.Equal(t, "Purchases", attrs["db.collection.name"].AsString())
+	assert.Equal(t, sql, attrs["db.query.text"].AsString())
+	assert.Equal(t, int64(1), attrs["db.response.rows_affected"].AsInt64())
+	assert.Equal(t, codes.Unset, insert.Status().Code)
+
+	assert.Equal(t, "SELECT Stores", selectStore.Name())
+	assert.Equal(t, codes.Error, selectStore.Status().Code)
+}
+
+func TestQueryTracer_IgnoresQueriesOutsideATrace(t *testing.T) {
+	recorder := record(t)
+	tracer := NewQueryTracer()
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	assert.Empty(t, recorder.Ended())
+}
+
+func TestStatement(t *testing.T) {
+	tests := []struct {
+		sql, operation, table string
+	}{
+		{"SELECT version()", "SELECT", ""},
+		{"begin", "BEGIN", ""},
+		{"\n\t\tUPDATE User_Sticker_Progress SET star_count=$1 WHERE user_id=$2", "UPDATE", "User_Sticker_Progress"},
+		{"DELETE FROM Webhooks WHERE store_id = $1", "DELETE", "Webhooks"},
+		{"SELECT COUNT(*) FROM (SELECT 1 FROM Purchases) p", "SELECT", "Purchases"},
+		{"WITH due AS (\n\tSELECT delivery_id FROM Webhook_Deliveries\n)", "WITH", "Webhook_Deliveries"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		operation, table := statement(tt.sql)
+		assert.Equal(t, tt.operation, operation, tt.sql)
+		assert.Equal(t, tt.table, table, tt.sql)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: "none", SampleRatio: 1})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Equal(t, []string{"traceparent", "tracestate"}, otel.GetTextMapPropagator().Fields())
+
+	_, err = Setup(context.Background(), config.Tracing{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
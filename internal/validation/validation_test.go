@@ -0,0 +1,66 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/m-garey/fetchit-backend/internal/apperr"
+	"github.com/m-garey/fetchit-backend/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sample struct {
+	Name    string `json:"name" binding:"required,max=5"`
+	OwnerID string `json:"owner_id" binding:"required,uuid"`
+	Tag     string `uri:"tag" binding:"omitempty,oneof=a b"`
+}
+
+func TestError_FieldDetails(t *testing.T) {
+	validation.Register()
+
+	err := binding.Validator.ValidateStruct(sample{Name: "too long", OwnerID: "nope", Tag: "c"})
+	require.Error(t, err)
+
+	var domainErr *apperr.Error
+	require.ErrorAs(t, validation.Error(err), &domainErr)
+	assert.Equal(t, apperr.KindValidation, domainErr.Kind)
+	assert.Equal(t, "invalid request", domainErr.Message)
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "name", Rule: "max", Message: "must be at most 5 characters"},
+		{Field: "owner_id", Rule: "uuid", Message: "must be a UUID"},
+		{Field: "tag", Rule: "oneof", Message: "must be one of: a b"},
+	}, domainErr.Fields)
+}
+
+func TestError_Required(t *testing.T) {
+	validation.Register()
+
+	err := binding.Validator.ValidateStruct(sample{})
+	require.Error(t, err)
+
+	var domainErr *apperr.Error
+	require.ErrorAs(t, validation.Error(err), &domainErr)
+	require.Len(t, domainErr.Fields, 2)
+	assert.Equal(t, "is required", domainErr.Fields[0].Message)
+}
+
+func TestError_TypeMismatch(t *testing.T) {
+	var s sample
+	err := json.Unmarshal([]byte(`{"name": 42}`), &s)
+	require.Error(t, err)
+
+	var domainErr *apperr.Error
+	require.ErrorAs(t, validation.Error(err), &domainErr)
+	assert.Equal(t, []apperr.FieldError{{Field: "name", Rule: "type", Message: "must be a string"}}, domainErr.Fields)
+}
+
+func TestError_MalformedBody(t *testing.T) {
+	cause := errors.New("unexpected EOF")
+	err := validation.Error(cause)
+
+	assert.Equal(t, apperr.KindValidation, apperr.KindOf(err))
+	assert.ErrorIs(t, err, cause)
+}
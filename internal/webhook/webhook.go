@@ -0,0 +1,250 @@
+// Package webhook sends queued webhook deliveries, signed with the webhook's
+// secret, and retries failures with exponential backoff until they are
+// delivered or dead-lettered.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m-garey/fetchit-backend/internal/models"
+)
+
+// Headers sent with every delivery. The signature header is
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">", so a
+// receiver can check both the body and how old it is.
+const (
+	SignatureHeader = "X-Fetchit-Signature"
+	EventHeader     = "X-Fetchit-Event"
+	DeliveryHeader  = "X-Fetchit-Delivery"
+)
+
+const (
+	secretPrefix = "whsec_"
+
+	defaultMaxAttempts  = 8
+	defaultBackoff      = 30 * time.Second
+	defaultPollInterval = time.Second
+	defaultTimeout      = 10 * time.Second
+	maxBackoff          = 6 * time.Hour
+	batchSize           = 20
+	maxErrorLength      = 500
+)
+
+// Store is where deliveries are queued. repository.Repository implements it.
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.DueWebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, deliveryID string, attempt models.WebhookAttempt) error
+}
+
+// Envelope is the body of a delivery.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewSecret returns a random signing secret for a new webhook.
+func NewSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return secretPrefix + hex.EncodeToString(b)
+}
+
+// Sign returns the signature header for a body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher polls the store for due deliveries and sends them.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	maxAttempts  int
+	backoff      time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+type Option func(*Dispatcher)
+
+// WithMaxAttempts sets how many failed attempts dead-letter a delivery.
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the wait before the first retry. Each later retry waits
+// twice as long as the one before, up to six hours.
+func WithBackoff(backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = backoff
+	}
+}
+
+// WithPollInterval sets how long the dispatcher idles when nothing is due.
+func WithPollInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.pollInterval = interval
+	}
+}
+
+// WithTimeout bounds each delivery request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.client.Timeout = timeout
+	}
+}
+
+// WithClient replaces the client deliveries are sent with. The default one
+// refuses private addresses and redirects; a replacement is trusted as is.
+func WithClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+func NewDispatcher(store Store, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:        store,
+		client:       newClient(defaultTimeout),
+		maxAttempts:  defaultMaxAttempts,
+		backoff:      defaultBackoff,
+		pollInterval: defaultPollInterval,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Run dispatches until ctx is cancelled. Deliveries in flight when it stops
+// are retried once their claim runs out.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("claiming webhook deliveries failed", "error", err)
+		}
+		if n == batchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.pollInterval):
+		}
+	}
+}
+
+// DispatchOnce sends the deliveries that are due and returns how many it
+// claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	// A claim outlives the slowest request, so no one else sends the delivery
+	// while it is in flight.
+	due, err := d.store.ClaimWebhookDeliveries(ctx, batchSize, 2*d.client.Timeout+d.pollInterval)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt := d.send(ctx, delivery)
+			if ctx.Err() != nil {
+				return
+			}
+			if err := d.store.RecordWebhookAttempt(ctx, delivery.ID, attempt); err != nil {
+				slog.ErrorContext(ctx, "recording webhook attempt failed", "delivery_id", delivery.ID, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery models.DueWebhookDelivery) models.WebhookAttempt {
+	body, err := json.Marshal(Envelope{
+		ID:        delivery.ID,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return d.failed(delivery, 0, err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return d.failed(delivery, 0, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fetchit-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return d.failed(delivery, 0, err.Error())
+	}
+	defer resp.Body.Close()
+	// Draining a little lets the connection be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return d.failed(delivery, resp.StatusCode, fmt.Sprintf("unexpected status %s", resp.Status))
+	}
+	return models.WebhookAttempt{Status: models.DeliveryDelivered, StatusCode: resp.StatusCode}
+}
+
+// failed schedules the next attempt, or dead-letters the delivery once it has
+// used up its attempts.
+func (d *Dispatcher) failed(delivery models.DueWebhookDelivery, statusCode int, msg string) models.WebhookAttempt {
+	if len(msg) > maxErrorLength {
+		msg = msg[:maxErrorLength]
+	}
+	attempts := delivery.Attempts + 1
+	if attempts >= d.maxAttempts {
+		return models.WebhookAttempt{Status: models.DeliveryDead, StatusCode: statusCode, Error: msg}
+	}
+	return models.WebhookAttempt{
+		Status:     models.DeliveryPending,
+		StatusCode: statusCode,
+		Error:      msg,
+		RetryIn:    d.retryIn(attempts),
+	}
+}
+
+// retryIn is the wait after the given number of failed attempts.
+func (d *Dispatcher) retryIn(attempts int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-garey/fetchit-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore hands out its deliveries once and records the attempts made.
+type memoryStore struct {
+	mu       sync.Mutex
+	due      []models.DueWebhookDelivery
+	attempts map[string]models.WebhookAttempt
+}
+
+func newMemoryStore(due ...models.DueWebhookDelivery) *memoryStore {
+	return &memoryStore{due: due, attempts: make(map[string]models.WebhookAttempt)}
+}
+
+func (s *memoryStore) ClaimWebhookDeliveries(_ context.Context, limit int, _ time.Duration) ([]models.DueWebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := min(limit, len(s.due))
+	claimed := s.due[:n]
+	s.due = s.due[n:]
+	return claimed, nil
+}
+
+func (s *memoryStore) RecordWebhookAttempt(_ context.Context, deliveryID string, attempt models.WebhookAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts[deliveryID] = attempt
+	return nil
+}
+
+func (s *memoryStore) attempt(deliveryID string) (models.WebhookAttempt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[deliveryID]
+	return a, ok
+}
+
+func testDelivery(url string, attempts int) models.DueWebhookDelivery {
+	return models.DueWebhookDelivery{
+		ID:        "8f14e45f-ceea-4e7a-9c3b-2a1d0e9f8b7c",
+		EventType: models.EventLevelUp,
+		Payload:   json.RawMessage(`{"level":"silver"}`),
+		Attempts:  attempts,
+		CreatedAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		URL:       url,
+		Secret:    "whsec_test",
+	}
+}
+
+func TestDispatcher_DeliversSignedEvent(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 5, 0, time.UTC)
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	delivery := testDelivery(receiver.URL, 0)
+	store := newMemoryStore(delivery)
+	d := NewDispatcher(store, WithClient(receiver.Client()))
+	d.now = func() time.Time { return now }
+
+	n, err := d.DispatchOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	require.NotNil(t, got)
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, models.EventLevelUp, got.Header.Get(EventHeader))
+	assert.Equal(t, delivery.ID, got.Header.Get(DeliveryHeader))
+	assert.Equal(t, Sign("whsec_test", now, body), got.Header.Get(SignatureHeader))
+	assert.True(t, strings.HasPrefix(got.Header.Get(SignatureHeader), "t=1748779205,v1="))
+	assert.JSONEq(t, `{
+		"id": "8f14e45f-ceea-4e7a-9c3b-2a1d0e9f8b7c",
+		"type": "level_up",
+		"created_at": "2025-06-01T12:00:00Z",
+		"data": {"level": "silver"}
+	}`, string(body))
+
+	attempt, ok := store.attempt(delivery.ID)
+	require.True(t, ok)
+	assert.Equal(t, models.WebhookAttempt{Status: models.DeliveryDelivered, StatusCode: http.StatusNoContent}, attempt)
+}
+
+func TestDispatcher_RetriesFailuresWithBackoff(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	delivery := testDelivery(receiver.URL, 2)
+	store := newMemoryStore(delivery)
+	_, err := NewDispatcher(store, WithBackoff(time.Minute), WithClient(receiver.Client())).DispatchOnce(context.Background())
+	require.NoError(t, err)
+
+	attempt, ok := store.attempt(delivery.ID)
+	require.True(t, ok)
+	assert.Equal(t, models.DeliveryPending, attempt.Status)
+	assert.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+	assert.Equal(t, "unexpected status 500 Internal Server Error", attempt.Error)
+	assert.Equal(t, 4*time.Minute, attempt.RetryIn)
+}
+
+func TestDispatcher_DeadLettersAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer receiver.Close()
+
+	delivery := testDelivery(receiver.URL, 2)
+	store := newMemoryStore(delivery)
+	_, err := NewDispatcher(store, WithMaxAttempts(3), WithClient(receiver.Client())).DispatchOnce(context.Background())
+	require.NoError(t, err)
+
+	attempt, _ := store.attempt(delivery.ID)
+	assert.Equal(t, models.DeliveryDead, attempt.Status)
+	assert.Equal(t, http.StatusGone, attempt.StatusCode)
+	assert.Zero(t, attempt.RetryIn)
+}
+
+func TestDispatcher_UnreachableReceiver(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url, client := receiver.URL, receiver.Client()
+	receiver.Close()
+
+	delivery := testDelivery(url, 0)
+	store := newMemoryStore(delivery)
+	_, err := NewDispatcher(store, WithClient(client)).DispatchOnce(context.Background())
+	require.NoError(t, err)
+
+	attempt, _ := store.attempt(delivery.ID)
+	assert.Equal(t, models.DeliveryPending, attempt.Status)
+	assert.Zero(t, attempt.StatusCode)
+	assert.NotEmpty(t, attempt.Error)
+	assert.Equal(t, defaultBackoff, attempt.RetryIn)
+}
+
+func TestDispatcher_RetryInIsCapped(t *testing.T) {
+	d := NewDispatcher(newMemoryStore(), WithBackoff(time.Minute))
+	assert.Equal(t, time.Minute, d.retryIn(1))
+	assert.Equal(t, 2*time.Minute, d.retryIn(2))
+	assert.Equal(t, maxBackoff, d.retryIn(100))
+}
+
+func TestDispatcher_RunStopsWithContext(t *testing.T) {
+	delivered := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewDispatcher(newMemoryStore(testDelivery(receiver.URL, 0)), WithPollInterval(time.Millisecond), WithClient(receiver.Client())).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("delivery was not sent")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestDispatcher_RefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	// The default client is used, and the receiver listens on loopback.
+	delivery := testDelivery(receiver.URL, 0)
+	store := newMemoryStore(delivery)
+	_, err := NewDispatcher(store).DispatchOnce(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, called)
+	attempt, _ := store.attempt(delivery.ID)
+	assert.Equal(t, models.DeliveryPending, attempt.Status)
+	assert.Contains(t, attempt.Error, ErrPrivateAddress.Error())
+}
+
+func TestDispatcher_DoesNotFollowRedirects(t *testing.T) {
+	var followed bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	// Only the dialer is swapped so the loopback receiver is reachable.
+	client := newClient(time.Second)
+	client.Transport = receiver.Client().Transport
+	delivery := testDelivery(receiver.URL, 0)
+	store := newMemoryStore(delivery)
+	_, err := NewDispatcher(store, WithClient(client)).DispatchOnce(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, followed)
+	attempt, _ := store.attempt(delivery.ID)
+	assert.Equal(t, http.StatusTemporaryRedirect, attempt.StatusCode)
+	assert.Equal(t, models.DeliveryPending, attempt.Status)
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+		ok      bool
+	}{
+		{"https://partner.example.com/hooks", false, true},
+		{"https://8.8.8.8/hooks", false, true},
+		{"http://partner.example.com/hooks", false, false},
+		{"https://localhost/hooks", true, false},
+		{"https://api.localhost./hooks", true, false},
+		{"https://127.0.0.1:8080/hooks", true, false},
+		{"https://169.254.169.254/latest/meta-data", true, false},
+		{"https://10.1.2.3/hooks", true, false},
+		{"https://192.168.0.10/hooks", true, false},
+		{"https://100.64.0.1/hooks", true, false},
+		{"https://[::1]/hooks", true, false},
+		{"https://[fd00::1]/hooks", true, false},
+		{"https://[::ffff:10.0.0.1]/hooks", true, false},
+		{"https://0.0.0.0/hooks", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(tt.url)
+			if tt.ok {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Equal(t, tt.private, errors.Is(err, ErrPrivateAddress))
+		})
+	}
+}